@@ -12,9 +12,48 @@ package couchdb // import "tideland.dev/go/db/couchdb"
 //--------------------
 
 import (
-	"fmt"
+	"encoding/json"
+
+	"tideland.dev/go/trace/failure"
 )
 
+//--------------------
+// SEQUENCE
+//--------------------
+
+// Sequence is a checkpoint inside the changes feed. It keeps the
+// original JSON form, a number for CouchDB 1 and an opaque string
+// since CouchDB 2, so that it can be stored and restored exactly.
+type Sequence struct {
+	raw json.RawMessage
+}
+
+// String returns the sequence in the form needed by Since().
+func (s Sequence) String() string {
+	var str string
+	if err := json.Unmarshal(s.raw, &str); err == nil {
+		return str
+	}
+	return string(s.raw)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s Sequence) MarshalJSON() ([]byte, error) {
+	if len(s.raw) == 0 {
+		return []byte("null"), nil
+	}
+	return s.raw, nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *Sequence) UnmarshalJSON(data []byte) error {
+	if !json.Valid(data) {
+		return failure.New("invalid sequence %q", data)
+	}
+	s.raw = append(json.RawMessage{}, data...)
+	return nil
+}
+
 //--------------------
 // CHANGES
 //--------------------
@@ -47,7 +86,13 @@ func newChanges(db *Database, params ...Parameter) (*Changes, error) {
 
 // LastSequence returns the sequence ID of the last change.
 func (c *Changes) LastSequence() string {
-	return fmt.Sprintf("%v", c.changes.LastSequence)
+	return c.changes.LastSequence.String()
+}
+
+// Checkpoint returns the sequence of the last change to store
+// it for a later resumption of the changes feed.
+func (c *Changes) Checkpoint() Sequence {
+	return c.changes.LastSequence
 }
 
 // Pending returns the number of pending changes if the
@@ -68,8 +113,8 @@ func (c *Changes) Process(process ChangeProcessor) error {
 		for _, change := range result.Changes {
 			revisions = append(revisions, change.Revision)
 		}
-		seq := fmt.Sprintf("%v", result.Sequence)
-		doc := NewUnmarshableJSON(result.Document)
+		seq := result.Sequence.String()
+		doc := newUnmarshable(c.db, result.Document)
 		if err := process(result.ID, seq, result.Deleted, revisions, doc); err != nil {
 			return err
 		}
@@ -77,4 +122,20 @@ func (c *Changes) Process(process ChangeProcessor) error {
 	return nil
 }
 
+// ProcessDocuments iterates over the found changes and processes
+// the changed documents. They are only contained if the changes are
+// requested with IncludeDocuments(), otherwise the document is nil.
+func (c *Changes) ProcessDocuments(process DocumentProcessor) error {
+	for _, result := range c.changes.Results {
+		var doc *Unmarshable
+		if len(result.Document) > 0 && string(result.Document) != "null" {
+			doc = newUnmarshable(c.db, result.Document)
+		}
+		if err := process(result.ID, doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // EOF
@@ -12,6 +12,10 @@ package couchdb_test // import "tideland.dev/go/db/couchdb_test"
 //--------------------
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"tideland.dev/go/audit/asserts"
@@ -65,4 +69,137 @@ func TestChanges(t *testing.T) {
 	assert.Equal(chgs.Len(), count)
 }
 
+// TestChangesFilterSelector tests retrieving changes filtered
+// by a selector.
+func TestChangesFilterSelector(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	cdb, cleanup := prepareDatabase(assert, "changes-selector")
+	defer cleanup()
+
+	// Create documents with different ages.
+	for i := 0; i < 10; i++ {
+		doc := Worker{
+			DocumentID: fmt.Sprintf("worker-%d", i),
+			Name:       fmt.Sprintf("Worker %d", i),
+			Age:        20 + i,
+		}
+		resp := cdb.CreateDocument(doc)
+		assert.True(resp.IsOK())
+	}
+
+	// Only changes of matching documents are returned.
+	chgs, err := cdb.Changes(couchdb.FilterSelector(json.RawMessage(`{"age": {"$gte": 25}}`)), couchdb.IncludeDocuments())
+	assert.NoError(err)
+	assert.Equal(chgs.Len(), 5)
+	err = chgs.Process(func(id, sequence string, deleted bool, revisions []string, document *couchdb.Unmarshable) error {
+		worker := Worker{}
+		err := document.Unmarshal(&worker)
+		assert.Nil(err)
+		assert.True(worker.Age >= 25)
+		return err
+	})
+	assert.Nil(err)
+}
+
+// TestChangesDocuments tests retrieving the documents of
+// changes inline.
+func TestChangesDocuments(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	cdb, cleanup := prepareDatabase(assert, "changes-documents")
+	defer cleanup()
+
+	for i := 0; i < 10; i++ {
+		doc := Worker{
+			DocumentID: fmt.Sprintf("worker-%d", i),
+			Name:       fmt.Sprintf("Worker %d", i),
+			Age:        20 + i,
+		}
+		resp := cdb.CreateDocument(doc)
+		assert.True(resp.IsOK())
+	}
+
+	// Documents are included.
+	chgs, err := cdb.Changes(couchdb.IncludeDocuments())
+	assert.NoError(err)
+	assert.Equal(chgs.Len(), 10)
+	err = chgs.ProcessDocuments(func(id string, document *couchdb.Unmarshable) error {
+		assert.NotNil(document)
+		worker := Worker{}
+		err := document.Unmarshal(&worker)
+		assert.Nil(err)
+		assert.Equal(worker.DocumentID, id)
+		assert.Equal(worker.Name, fmt.Sprintf("Worker %d", worker.Age-20))
+		return err
+	})
+	assert.Nil(err)
+
+	// Documents are not included.
+	chgs, err = cdb.Changes()
+	assert.NoError(err)
+	assert.Equal(chgs.Len(), 10)
+	err = chgs.ProcessDocuments(func(id string, document *couchdb.Unmarshable) error {
+		assert.Nil(document)
+		return nil
+	})
+	assert.Nil(err)
+}
+
+// TestChangesCheckpoint tests storing and restoring the sequence
+// of the last change. A fake server returns CouchDB 1 and 2 sequences.
+func TestChangesCheckpoint(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	opaque := "42-g1AAAAFTeJzLYWBgYMlgTmFQSElKzi9KdUhJMtTLTc3PK0lNzi9KdSgwAAA"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		switch r.URL.Query().Get("since") {
+		case "":
+			fmt.Fprintf(w, `{"results": [], "last_seq": %q, "pending": 0}`, opaque)
+		case opaque:
+			w.Write([]byte(`{"results": [], "last_seq": 12345678901, "pending": 0}`))
+		case "12345678901":
+			w.Write([]byte(`{"results": [], "last_seq": "done", "pending": 0}`))
+		default:
+			w.Write([]byte(`{"results": [], "last_seq": "unexpected", "pending": 0}`))
+		}
+	}))
+	defer srv.Close()
+	address, port := splitHostPort(assert, srv.URL)
+
+	cdb, err := couchdb.Open(couchdb.Host(address, port), couchdb.Name("checkpoint"))
+	assert.Nil(err)
+
+	// Opaque string sequence of CouchDB 2.
+	chgs, err := cdb.Changes()
+	assert.NoError(err)
+	checkpoint := chgs.Checkpoint()
+	assert.Equal(checkpoint.String(), opaque)
+	assert.Equal(chgs.LastSequence(), opaque)
+	stored, err := json.Marshal(checkpoint)
+	assert.Nil(err)
+	assert.Equal(string(stored), fmt.Sprintf("%q", opaque))
+	restored := couchdb.Sequence{}
+	err = json.Unmarshal(stored, &restored)
+	assert.Nil(err)
+
+	// Numeric sequence of CouchDB 1 keeps its exact form.
+	chgs, err = cdb.Changes(couchdb.Since(restored.String()))
+	assert.NoError(err)
+	checkpoint = chgs.Checkpoint()
+	assert.Equal(checkpoint.String(), "12345678901")
+	stored, err = json.Marshal(checkpoint)
+	assert.Nil(err)
+	assert.Equal(string(stored), "12345678901")
+	err = json.Unmarshal(stored, &restored)
+	assert.Nil(err)
+
+	chgs, err = cdb.Changes(couchdb.Since(restored.String()))
+	assert.NoError(err)
+	assert.Equal(chgs.LastSequence(), "done")
+
+	// Empty sequence.
+	stored, err = json.Marshal(couchdb.Sequence{})
+	assert.Nil(err)
+	assert.Equal(string(stored), "null")
+}
+
 // EOF
@@ -12,10 +12,12 @@ package couchdb // import "tideland.dev/go/db/couchdb"
 //--------------------
 
 import (
+	"encoding/json"
+	"net/http"
 	"reflect"
 	"strings"
+	"time"
 
-	"tideland.dev/go/dsa/identifier"
 	"tideland.dev/go/trace/failure"
 )
 
@@ -25,24 +27,45 @@ import (
 
 // Database provides the access to a database.
 type Database struct {
-	host    string
-	name    string
-	logging bool
+	scheme          string
+	host            string
+	name            string
+	authorization   string
+	logging         bool
+	compression     bool
+	conflictRetries int
+	idGenerator     func() string
+	timeout         time.Duration
+	transport       *http.Transport
+	client          *http.Client
+	observer        RequestObserver
+	marshal         func(v interface{}) ([]byte, error)
+	unmarshal       func(data []byte, v interface{}) error
 }
 
 // Open returns a configured connection to a CouchDB server.
 // Permanent parameters, e.g. for authentication, are possible.
 func Open(options ...Option) (*Database, error) {
 	db := &Database{
-		host:    defaultHost,
-		name:    defaultName,
-		logging: defaultLogging,
+		scheme:          defaultScheme,
+		host:            defaultHost,
+		name:            defaultName,
+		logging:         defaultLogging,
+		compression:     defaultCompression,
+		conflictRetries: defaultConflictRetries,
+		idGenerator:     defaultIDGenerator,
 	}
 	for _, option := range options {
 		if err := option(db); err != nil {
 			return nil, err
 		}
 	}
+	db.client = &http.Client{
+		Timeout: db.timeout,
+	}
+	if db.transport != nil {
+		db.client.Transport = db.transport
+	}
 	return db, nil
 }
 
@@ -61,34 +84,46 @@ func (db *Database) Designs() *Designs {
 	return newDesigns(db)
 }
 
-// StartSession starts a cookie based session for the given user.
-func (db *Database) StartSession(name, password string) (*Session, error) {
-	user := User{
-		Name:     name,
-		Password: password,
+// Ping checks with a lightweight request to the welcome endpoint
+// if the server is reachable and healthy. It doesn't need an existing
+// database, so it can be used for readiness or liveness probes.
+func (db *Database) Ping(params ...Parameter) error {
+	rs := db.Request().ApplyParameters(params...).Get()
+	if rs.err != nil {
+		return failure.Annotate(rs.err, "cannot reach CouchDB")
 	}
-	rs := db.Request().SetPath("_session").SetDocument(user).Post()
-	if !rs.IsOK() {
-		return nil, rs.Error()
+	if rs.StatusCode() != StatusOK {
+		return failure.New("CouchDB not healthy: status code %d", rs.StatusCode())
 	}
-	roles := couchdbRoles{}
-	err := rs.Document(&roles)
+	return nil
+}
+
+// StartSession starts a cookie based session for the given user.
+func (db *Database) StartSession(name, password string) (*Session, error) {
+	userName, authSession, expiresAt, err := db.authenticate(name, password)
 	if err != nil {
 		return nil, err
 	}
-	setCookie := rs.Header("Set-Cookie")
-	authSession := ""
-	for _, part := range strings.Split(setCookie, ";") {
-		if strings.HasPrefix(part, "AuthSession=") {
-			authSession = part
-			break
-		}
-	}
 	s := &Session{
 		db:          db,
-		name:        roles.Name,
+		name:        userName,
 		authSession: authSession,
+		expiresAt:   expiresAt,
+	}
+	return s, nil
+}
+
+// AuthenticatedSession starts a cookie based session for the given
+// user like StartSession. Additionally the session transparently
+// authenticates again when a request using its cookie is answered
+// with status unauthorized. The request then is retried once.
+func (db *Database) AuthenticatedSession(name, password string) (*Session, error) {
+	s, err := db.StartSession(name, password)
+	if err != nil {
+		return nil, err
 	}
+	s.password = password
+	s.autoRefresh = true
 	return s, nil
 }
 
@@ -111,6 +146,62 @@ func (db *Database) AllDocumentIDs(params ...Parameter) ([]string, error) {
 	return ids, nil
 }
 
+// DocumentProcessor is a function processing a document with its ID.
+type DocumentProcessor func(id string, document *Unmarshable) error
+
+// AllDocuments iterates over all documents of the configured database
+// and processes them. Parameters like StartEndKey() or Limit() allow
+// to iterate over a window of documents.
+func (db *Database) AllDocuments(process DocumentProcessor, params ...Parameter) error {
+	params = append(params, IncludeDocuments())
+	rs := db.Request().SetPath(db.name, "_all_docs").ApplyParameters(params...).GetOrPost()
+	if !rs.IsOK() {
+		return rs.Error()
+	}
+	docs := couchdbView{}
+	err := rs.Document(&docs)
+	if err != nil {
+		return err
+	}
+	for _, row := range docs.Rows {
+		if err := process(row.ID, newUnmarshable(db, row.Document)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CountDocuments returns the number of documents of the configured
+// database including the design documents. Without key parameters
+// only the total number is requested. With parameters like StartEndKey()
+// or Keys() the documents of the key range are counted. Others, e.g.
+// for authentication, don't change this.
+func (db *Database) CountDocuments(params ...Parameter) (int, error) {
+	req := db.Request().SetPath(db.name, "_all_docs").ApplyParameters(params...)
+	ranged := req.doc != nil
+	for _, key := range []string{"startkey", "endkey", "key", "keys"} {
+		if _, ok := req.query[key]; ok {
+			ranged = true
+		}
+	}
+	if !ranged {
+		req.SetQuery("limit", "0")
+	}
+	rs := req.GetOrPost()
+	if !rs.IsOK() {
+		return 0, rs.Error()
+	}
+	rows := couchdbRows{}
+	err := rs.Document(&rows)
+	if err != nil {
+		return 0, err
+	}
+	if !ranged {
+		return rows.TotalRows, nil
+	}
+	return len(rows.Rows), nil
+}
+
 // HasDocument checks if the document with the ID exists.
 func (db *Database) HasDocument(id string, params ...Parameter) (bool, error) {
 	rs := db.Request().SetPath(db.name, id).ApplyParameters(params...).Head()
@@ -123,14 +214,42 @@ func (db *Database) HasDocument(id string, params ...Parameter) (bool, error) {
 	return false, rs.Error()
 }
 
+// PartitionInfo returns the information about the partition
+// with the given name of a partitioned database.
+func (db *Database) PartitionInfo(partition string, params ...Parameter) (*PartitionInfo, error) {
+	rs := db.Request().SetPath(db.name, "_partition", partition).ApplyParameters(params...).Get()
+	if !rs.IsOK() {
+		return nil, rs.Error()
+	}
+	info := PartitionInfo{}
+	err := rs.Document(&info)
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// DocumentRevision returns the current revision of the document
+// with the ID without reading the document itself.
+func (db *Database) DocumentRevision(id string, params ...Parameter) (string, error) {
+	rs := db.Request().SetPath(db.name, id).ApplyParameters(params...).Head()
+	if !rs.IsOK() {
+		if rs.StatusCode() == StatusNotFound {
+			return "", failure.New("document with identifier '%s' not found", id)
+		}
+		return "", rs.Error()
+	}
+	return strings.Trim(rs.Header("Etag"), `"`), nil
+}
+
 // CreateDocument creates a new document.
 func (db *Database) CreateDocument(doc interface{}, params ...Parameter) *ResultSet {
 	id, _, err := db.idAndRevision(doc)
 	if err != nil {
-		return newResultSet(nil, err)
+		return newResultSet(db, nil, err)
 	}
 	if id == "" {
-		id = identifier.NewUUID().ShortString()
+		id = db.idGenerator()
 	}
 	return db.Request().SetPath(db.name, id).SetDocument(doc).ApplyParameters(params...).Put()
 }
@@ -140,37 +259,76 @@ func (db *Database) ReadDocument(id string, params ...Parameter) *ResultSet {
 	return db.Request().SetPath(db.name, id).ApplyParameters(params...).Get()
 }
 
+// ReadDocumentInto reads the document by ID and decodes it directly
+// out of the response into the passed value. Opposite to ReadDocument()
+// the body is not buffered, so it is more efficient for large documents.
+func (db *Database) ReadDocumentInto(id string, doc interface{}, params ...Parameter) error {
+	return db.Request().SetPath(db.name, id).ApplyParameters(params...).stream(http.MethodGet, doc)
+}
+
 // UpdateDocument update a document if exists.
 func (db *Database) UpdateDocument(doc interface{}, params ...Parameter) *ResultSet {
 	id, _, err := db.idAndRevision(doc)
 	if err != nil {
-		return newResultSet(nil, err)
+		return newResultSet(db, nil, err)
 	}
 	if id == "" {
-		return newResultSet(nil, failure.New("document contains no identifier"))
+		return newResultSet(db, nil, failure.New("document contains no identifier"))
 	}
 	hasDoc, err := db.HasDocument(id)
 	if err != nil {
-		return newResultSet(nil, err)
+		return newResultSet(db, nil, err)
 	}
 	if !hasDoc {
-		return newResultSet(nil, failure.New("document with identifier '%s' not found", id))
+		return newResultSet(db, nil, failure.New("document with identifier '%s' not found", id))
 	}
 	return db.Request().SetPath(db.name, id).SetDocument(doc).ApplyParameters(params...).Put()
 }
 
+// Modifier is a function receiving the current document and returning
+// the modified one for the writing.
+type Modifier func(document *Unmarshable) (interface{}, error)
+
+// Modify reads the document with the given ID, lets the modifier
+// change it, and writes it back. In case of a conflict due to a
+// concurrent update the document is read and modified again. The
+// number of retries can be set with the option ConflictRetries().
+func (db *Database) Modify(id string, modify Modifier, params ...Parameter) *ResultSet {
+	var rs *ResultSet
+	for attempt := 0; attempt <= db.conflictRetries; attempt++ {
+		rs = db.ReadDocument(id, params...)
+		if !rs.IsOK() {
+			return rs
+		}
+		raw, err := rs.Raw()
+		if err != nil {
+			return newResultSet(db, nil, err)
+		}
+		doc, err := modify(newUnmarshable(db, raw))
+		if err != nil {
+			return newResultSet(db, nil, err)
+		}
+		writeParams := append([]Parameter{Revision(rs.Revision())}, params...)
+		rs = db.Request().SetPath(db.name, id).SetDocument(doc).ApplyParameters(writeParams...).Put()
+		if rs.StatusCode() != StatusConflict {
+			return rs
+		}
+	}
+	return rs
+}
+
 // DeleteDocument deletes a existing document.
 func (db *Database) DeleteDocument(doc interface{}, params ...Parameter) *ResultSet {
 	id, revision, err := db.idAndRevision(doc)
 	if err != nil {
-		return newResultSet(nil, err)
+		return newResultSet(db, nil, err)
 	}
 	hasDoc, err := db.HasDocument(id)
 	if err != nil {
-		return newResultSet(nil, err)
+		return newResultSet(db, nil, err)
 	}
 	if !hasDoc {
-		return newResultSet(nil, failure.New("document with identifier '%s' not found", id))
+		return newResultSet(db, nil, failure.New("document with identifier '%s' not found", id))
 	}
 	params = append(params, Revision(revision))
 	return db.Request().SetPath(db.name, id).ApplyParameters(params...).Delete()
@@ -181,10 +339,10 @@ func (db *Database) DeleteDocument(doc interface{}, params ...Parameter) *Result
 func (db *Database) DeleteDocumentByID(id, revision string, params ...Parameter) *ResultSet {
 	hasDoc, err := db.HasDocument(id)
 	if err != nil {
-		return newResultSet(nil, err)
+		return newResultSet(db, nil, err)
 	}
 	if !hasDoc {
-		return newResultSet(nil, failure.New("document with identifier '%s' not found", id))
+		return newResultSet(db, nil, failure.New("document with identifier '%s' not found", id))
 	}
 	params = append(params, Revision(revision))
 	return db.Request().SetPath(db.name, id).ApplyParameters(params...).Delete()
@@ -196,6 +354,71 @@ func (db *Database) BulkWriteDocuments(docs []interface{}, params ...Parameter)
 	bulk := &couchdbBulkDocuments{
 		Docs: docs,
 	}
+	return db.bulkWrite(bulk, params...)
+}
+
+// BulkWriteAtomic is like BulkWriteDocuments but sets the all or
+// nothing mode. Here either all documents are written or none, and
+// conflicts are not checked, so conflicting revisions all land.
+// Take care, the mode is deprecated and ignored since CouchDB 2,
+// but still needed by some setups.
+func (db *Database) BulkWriteAtomic(docs []interface{}, params ...Parameter) (Statuses, error) {
+	bulk := &couchdbBulkDocuments{
+		Docs:         docs,
+		AllOrNothing: true,
+	}
+	return db.bulkWrite(bulk, params...)
+}
+
+// BulkReadDocuments reads the requested documents or revisions at
+// once. Parameters like Revisions() for the revision history or
+// Latest() can be applied. Missing documents or revisions are
+// returned with error and reason instead of the document.
+func (db *Database) BulkReadDocuments(reqs []BulkReadRequest, params ...Parameter) ([]BulkReadDocument, error) {
+	bulk := &couchdbBulkRead{
+		Docs: reqs,
+	}
+	rs := db.Request().SetPath(db.name, "_bulk_get").SetDocument(bulk).ApplyParameters(params...).Post()
+	if !rs.IsOK() {
+		return nil, rs.Error()
+	}
+	results := couchdbBulkReadResults{}
+	err := rs.Document(&results)
+	if err != nil {
+		return nil, err
+	}
+	brds := []BulkReadDocument{}
+	for _, result := range results.Results {
+		for _, entry := range result.Docs {
+			brd := BulkReadDocument{
+				ID: result.ID,
+			}
+			switch {
+			case len(entry.OK) > 0:
+				rd := couchdbRevisionsDocument{}
+				if err := unmarshalWith(db.unmarshal, entry.OK, &rd); err != nil {
+					return nil, failure.Annotate(err, "cannot unmarshal database document")
+				}
+				brd.Revision = rd.Revision
+				brd.History = rd.Revisions
+				brd.Document = newUnmarshable(db, entry.OK)
+			case entry.Error != nil:
+				brd.Revision = entry.Error.Revision
+				brd.Error = entry.Error.Error
+				brd.Reason = entry.Error.Reason
+			default:
+				brd.Revision = entry.Missing
+				brd.Error = "not_found"
+				brd.Reason = "missing"
+			}
+			brds = append(brds, brd)
+		}
+	}
+	return brds, nil
+}
+
+// bulkWrite performs the writing of the bulk documents.
+func (db *Database) bulkWrite(bulk *couchdbBulkDocuments, params ...Parameter) (Statuses, error) {
 	rs := db.Request().SetPath(db.name, "_bulk_docs").SetDocument(bulk).ApplyParameters(params...).Post()
 	if !rs.IsOK() {
 		return nil, rs.Error()
@@ -208,6 +431,39 @@ func (db *Database) BulkWriteDocuments(docs []interface{}, params ...Parameter)
 	return statuses, nil
 }
 
+// DeleteByFind deletes all documents found by the search. They are
+// found and deleted page by page, the page size is the limit of the
+// search. The returned statuses contain the result for each document.
+func (db *Database) DeleteByFind(search *Search, params ...Parameter) (Statuses, error) {
+	page := search.clone().Fields("_id", "_rev")
+	statuses := Statuses{}
+	for {
+		find, err := newFind(db, page, params...)
+		if err != nil {
+			return nil, err
+		}
+		if find.Len() == 0 {
+			break
+		}
+		docs := []interface{}{}
+		for _, raw := range find.find.Documents {
+			doc := couchdbDeletedDocument{}
+			if err := unmarshalWith(db.unmarshal, raw, &doc); err != nil {
+				return nil, failure.Annotate(err, "cannot unmarshal database document")
+			}
+			doc.Deleted = true
+			docs = append(docs, doc)
+		}
+		pageStatuses, err := db.BulkWriteDocuments(docs, params...)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, pageStatuses...)
+		page.Bookmark(find.find.Bookmark)
+	}
+	return statuses, nil
+}
+
 // Changes returns access to the changes of the configured database.
 func (db *Database) Changes(params ...Parameter) (*Changes, error) {
 	return newChanges(db, params...)
@@ -218,6 +474,66 @@ func (db *Database) View(designID, viewID string, params ...Parameter) (*View, e
 	return newView(db, designID, viewID, params...)
 }
 
+// SearchIndex queries the full-text search index of a design document
+// with a Lucene query. It needs a CouchDB with enabled search or Cloudant.
+func (db *Database) SearchIndex(designID, indexID, query string, params ...Parameter) (*SearchResult, error) {
+	return newSearchResult(db, designID, indexID, query, params...)
+}
+
+// Show executes the show function of a design document for the
+// document with the given ID and returns the rendered body and its
+// content type. The body is not necessarily JSON.
+func (db *Database) Show(designID, showID, docID string, params ...Parameter) (*Unmarshable, string, error) {
+	path := []string{db.name, "_design", designID, "_show", showID}
+	if docID != "" {
+		path = append(path, docID)
+	}
+	rs := db.Request().SetPath(path...).ApplyParameters(params...).Get()
+	if !rs.IsOK() {
+		return nil, "", rs.Error()
+	}
+	body, err := rs.Raw()
+	if err != nil {
+		return nil, "", err
+	}
+	return newUnmarshable(db, body), rs.Header("Content-Type"), nil
+}
+
+// List executes the list function of a design document over the
+// given view and returns the raw output and its content type. View
+// parameters like StartKey() or EndKey() can be applied.
+func (db *Database) List(designID, listID, viewID string, params ...Parameter) ([]byte, string, error) {
+	rs := db.Request().SetPath(db.name, "_design", designID, "_list", listID, viewID).ApplyParameters(params...).GetOrPost()
+	if !rs.IsOK() {
+		return nil, "", rs.Error()
+	}
+	body, err := rs.Raw()
+	if err != nil {
+		return nil, "", err
+	}
+	return body, rs.Header("Content-Type"), nil
+}
+
+// Update executes the update handler of a design document. With
+// a document ID the handler is called with the stored document per
+// POST, otherwise per PUT. The body is passed as request document.
+func (db *Database) Update(designID, updateID, docID string, body interface{}, params ...Parameter) *ResultSet {
+	req := db.Request()
+	if docID == "" {
+		req = req.SetPath(db.name, "_design", designID, "_update", updateID)
+	} else {
+		req = req.SetPath(db.name, "_design", designID, "_update", updateID, docID)
+	}
+	if body != nil {
+		req = req.SetDocument(body)
+	}
+	req = req.ApplyParameters(params...)
+	if docID == "" {
+		return req.Put()
+	}
+	return req.Post()
+}
+
 // Find runs a selection and returns access to the found results.
 func (db *Database) Find(search *Search, params ...Parameter) (*Find, error) {
 	return newFind(db, search, params...)
@@ -229,15 +545,53 @@ func (db *Database) Request() *Request {
 	return newRequest(db)
 }
 
+// authenticate posts the credentials to the session endpoint and
+// returns the user name and the session cookie.
+func (db *Database) authenticate(name, password string) (string, string, time.Time, error) {
+	user := User{
+		Name:     name,
+		Password: password,
+	}
+	rs := db.Request().SetPath("_session").SetDocument(user).Post()
+	if !rs.IsOK() {
+		return "", "", time.Time{}, rs.Error()
+	}
+	roles := couchdbRoles{}
+	err := rs.Document(&roles)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	authSession, expiresAt := parseSessionCookie(rs.Header("Set-Cookie"), time.Now())
+	return roles.Name, authSession, expiresAt, nil
+}
+
 // idAndRevision retrieves the ID and the revision of the
-// passed document.
+// passed document. It can be a struct with the according
+// JSON tags, a map, or a raw JSON document.
 func (db *Database) idAndRevision(doc interface{}) (string, string, error) {
+	switch typedDoc := doc.(type) {
+	case json.RawMessage:
+		return idAndRevisionFromRaw(typedDoc)
+	case *json.RawMessage:
+		if typedDoc == nil {
+			return "", "", failure.New("document needs _id and _rev")
+		}
+		return idAndRevisionFromRaw(*typedDoc)
+	}
 	v := reflect.Indirect(reflect.ValueOf(doc))
-	t := v.Type()
-	k := t.Kind()
-	if k != reflect.Struct {
-		return "", "", failure.New("document needs _id and _rev")
+	switch v.Kind() {
+	case reflect.Struct:
+		return idAndRevisionFromStruct(v)
+	case reflect.Map:
+		return idAndRevisionFromMap(v)
 	}
+	return "", "", failure.New("document needs _id and _rev")
+}
+
+// idAndRevisionFromStruct retrieves the ID and the revision
+// out of the fields tagged with _id and _rev.
+func idAndRevisionFromStruct(v reflect.Value) (string, string, error) {
+	t := v.Type()
 	var id string
 	var revision string
 	var found int
@@ -261,4 +615,48 @@ func (db *Database) idAndRevision(doc interface{}) (string, string, error) {
 	return id, revision, nil
 }
 
+// idAndRevisionFromMap retrieves the ID and the revision out
+// of the map entries _id and _rev. Both are allowed to be
+// missing, e.g. when creating a new document.
+func idAndRevisionFromMap(v reflect.Value) (string, string, error) {
+	if v.Type().Key().Kind() != reflect.String {
+		return "", "", failure.New("document needs _id and _rev")
+	}
+	entry := func(key string) (string, error) {
+		ev := v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key()))
+		if !ev.IsValid() {
+			return "", nil
+		}
+		if ev.Kind() == reflect.Interface {
+			if ev.IsNil() {
+				return "", nil
+			}
+			ev = ev.Elem()
+		}
+		if ev.Kind() != reflect.String {
+			return "", failure.New("document needs _id and _rev")
+		}
+		return ev.String(), nil
+	}
+	id, err := entry("_id")
+	if err != nil {
+		return "", "", err
+	}
+	revision, err := entry("_rev")
+	if err != nil {
+		return "", "", err
+	}
+	return id, revision, nil
+}
+
+// idAndRevisionFromRaw retrieves the ID and the revision out
+// of a raw JSON document.
+func idAndRevisionFromRaw(raw json.RawMessage) (string, string, error) {
+	doc := map[string]interface{}{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return "", "", failure.Annotate(err, "document needs _id and _rev")
+	}
+	return idAndRevisionFromMap(reflect.ValueOf(doc))
+}
+
 // EOF
@@ -12,7 +12,18 @@ package couchdb_test // import "tideland.dev/go/db/couchdb_test"
 //--------------------
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"tideland.dev/go/audit/asserts"
 	"tideland.dev/go/db/couchdb"
@@ -45,6 +56,333 @@ func TestInvalidConfiguration(t *testing.T) {
 	// Deleting the database has to fail.
 	resp := cdb.Manager().DeleteDatabase()
 	assert.Equal(resp.StatusCode(), couchdb.StatusBadRequest)
+
+	// Invalid option values are rejected.
+	_, err = couchdb.Open(couchdb.ConflictRetries(-1))
+	assert.ErrorMatch(err, ".*invalid configuration value in field 'conflict retries'.*")
+	_, err = couchdb.Open(couchdb.ConflictRetries(0))
+	assert.Nil(err)
+}
+
+// TestCompression tests writing and reading with
+// compression enabled.
+func TestCompression(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	count := 1000
+	cdb, err := couchdb.Open(couchdb.Name("tmp-compression"), couchdb.Compression())
+	assert.Nil(err)
+	cdb.Manager().DeleteDatabase()
+	resp := cdb.Manager().CreateDatabase()
+	assert.True(resp.IsOK())
+	defer cdb.Manager().DeleteDatabase()
+
+	// Write a large bulk of documents.
+	docs := generateDocuments(count)
+	results, err := cdb.BulkWriteDocuments(docs)
+	assert.Nil(err)
+	assert.Length(results, count)
+	for _, result := range results {
+		assert.True(result.OK)
+	}
+
+	// Read them back.
+	ids, err := cdb.AllDocumentIDs()
+	assert.Nil(err)
+	assert.Length(ids, count)
+
+	resp = cdb.ReadDocument(ids[0])
+	assert.True(resp.IsOK())
+	raw, err := resp.Raw()
+	assert.Nil(err)
+	doc := Worker{}
+	err = json.Unmarshal(raw, &doc)
+	assert.Nil(err)
+	assert.Equal(doc.DocumentID, ids[0])
+}
+
+// TestURL tests opening the database with a connection URL.
+func TestURL(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+
+	// Invalid URLs.
+	_, err := couchdb.Open(couchdb.URL("ftp://127.0.0.1:5984/foo"))
+	assert.ErrorMatch(err, ".*invalid connection URL scheme.*")
+	_, err = couchdb.Open(couchdb.URL("http://127.0.0.1:abc/foo"))
+	assert.ErrorMatch(err, ".*invalid connection URL.*")
+
+	// Valid URLs.
+	cdb, err := couchdb.Open(couchdb.URL("http://127.0.0.1:5984"))
+	assert.Nil(err)
+	assert.Equal(cdb.Name(), "default")
+
+	cdb, err = couchdb.Open(couchdb.URL("http://127.0.0.1/tmp-url"))
+	assert.Nil(err)
+	assert.Equal(cdb.Name(), "tmp-url")
+	_, err = cdb.Manager().Version()
+	assert.Nil(err)
+}
+
+// TestConnectionPool tests concurrent requests using
+// a connection pool.
+func TestConnectionPool(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	cdb, err := couchdb.Open(couchdb.Name("tmp-connection-pool"), couchdb.ConnectionPool(5, 10))
+	assert.Nil(err)
+	cdb.Manager().DeleteDatabase()
+	resp := cdb.Manager().CreateDatabase()
+	assert.True(resp.IsOK())
+	defer cdb.Manager().DeleteDatabase()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			doc := Worker{
+				DocumentID: fmt.Sprintf("worker-%d", i),
+				Name:       fmt.Sprintf("Worker %d", i),
+			}
+			errs <- cdb.CreateDocument(doc).Error()
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.Nil(err)
+	}
+	n, err := cdb.CountDocuments()
+	assert.Nil(err)
+	assert.Equal(n, 100)
+
+	_, err = couchdb.Open(couchdb.ConnectionPool(-1, 0))
+	assert.ErrorMatch(err, ".*invalid connection pool limits.*")
+}
+
+// TestTimeout tests requests to a hanging server.
+func TestTimeout(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	address, port := splitHostPort(assert, srv.URL)
+
+	cdb, err := couchdb.Open(couchdb.Host(address, port), couchdb.Timeout(50*time.Millisecond))
+	assert.Nil(err)
+	resp := cdb.ReadDocument("foo")
+	assert.False(resp.IsOK())
+	assert.ErrorMatch(resp.Error(), ".*cannot perform request.*")
+
+	_, err = couchdb.Open(couchdb.Timeout(-time.Second))
+	assert.ErrorMatch(err, ".*invalid timeout.*")
+}
+
+// TestPing tests the health check of reachable, unhealthy,
+// and unreachable servers.
+func TestPing(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	healthy := true
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(r.URL.Path, "/")
+		if !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error": "unavailable", "reason": "maintenance"}`))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"couchdb": "Welcome", "version": "3.1.1"}`))
+	}))
+	address, port := splitHostPort(assert, srv.URL)
+
+	cdb, err := couchdb.Open(couchdb.Host(address, port), couchdb.Name("not-existing"), couchdb.Timeout(time.Second))
+	assert.Nil(err)
+	assert.NoError(cdb.Ping())
+
+	mu.Lock()
+	healthy = false
+	mu.Unlock()
+	err = cdb.Ping()
+	assert.ErrorMatch(err, ".*not healthy: status code 503.*")
+
+	// Unreachable after closing the server.
+	srv.Close()
+	err = cdb.Ping()
+	assert.ErrorMatch(err, ".*cannot reach CouchDB.*cannot perform request.*")
+}
+
+// TestEmptyResponse tests handling successful responses
+// without body.
+func TestEmptyResponse(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	address, port := splitHostPort(assert, srv.URL)
+
+	cdb, err := couchdb.Open(couchdb.Host(address, port), couchdb.Name("empty"))
+	assert.Nil(err)
+
+	resp := cdb.Request().SetPath("empty", "foo").Put()
+	assert.True(resp.IsOK())
+	assert.Nil(resp.Error())
+	doc := Worker{}
+	err = resp.Document(&doc)
+	assert.Nil(err)
+	assert.Equal(doc, Worker{})
+	assert.Equal(resp.ID(), "")
+	assert.False(resp.IsDeleted())
+}
+
+// TestObserver tests the observing of requests.
+func TestObserver(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{"_id": "foo", "_rev": "1-abc"}`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error": "not_found", "reason": "missing"}`))
+	}))
+	defer srv.Close()
+	address, port := splitHostPort(assert, srv.URL)
+
+	stats := []couchdb.RequestStats{}
+	observer := func(s couchdb.RequestStats) {
+		stats = append(stats, s)
+	}
+	cdb, err := couchdb.Open(couchdb.Host(address, port), couchdb.Name("observed"), couchdb.Observer(observer))
+	assert.Nil(err)
+
+	resp := cdb.ReadDocument("foo")
+	assert.True(resp.IsOK())
+	resp = cdb.Request().SetPath("observed", "foo").Delete()
+	assert.False(resp.IsOK())
+
+	assert.Length(stats, 2)
+	assert.Equal(stats[0].Method, http.MethodGet)
+	assert.Equal(stats[0].Path, "/observed/foo")
+	assert.Equal(stats[0].StatusCode, couchdb.StatusOK)
+	assert.True(stats[0].BytesRead > 0)
+	assert.Nil(stats[0].Error)
+	assert.Equal(stats[1].Method, http.MethodDelete)
+	assert.Equal(stats[1].StatusCode, couchdb.StatusNotFound)
+}
+
+// TestCodec tests using a configured codec for documents.
+func TestCodec(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	finds := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		switch r.URL.Path {
+		case "/codec/foo":
+			w.Write([]byte(`{"_id": "foo", "_rev": "1-abc", "name": "foo", "age": 42}`))
+		case "/codec/_design/testing/_view/age":
+			w.Write([]byte(`{"total_rows": 1, "offset": 0, "rows": [{"id": "foo", "key": 42, "value": "foo"}]}`))
+		case "/codec/_find":
+			if finds++; finds == 1 {
+				w.Write([]byte(`{"docs": [{"_id": "foo", "_rev": "1-abc"}]}`))
+			} else {
+				w.Write([]byte(`{"docs": []}`))
+			}
+		case "/codec/_bulk_docs":
+			w.Write([]byte(`[{"ok": true, "id": "foo", "rev": "2-abc"}]`))
+		default:
+			w.Write([]byte(`{"ok": true, "id": "bar", "rev": "1-def"}`))
+		}
+	}))
+	defer srv.Close()
+	address, port := splitHostPort(assert, srv.URL)
+
+	var mu sync.Mutex
+	marshals := 0
+	unmarshals := 0
+	marshal := func(v interface{}) ([]byte, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		marshals++
+		return json.Marshal(v)
+	}
+	unmarshal := func(data []byte, v interface{}) error {
+		mu.Lock()
+		defer mu.Unlock()
+		unmarshals++
+		return json.Unmarshal(data, v)
+	}
+	cdb, err := couchdb.Open(couchdb.Host(address, port), couchdb.Name("codec"), couchdb.Codec(marshal, unmarshal))
+	assert.Nil(err)
+
+	// Writing and reading documents.
+	resp := cdb.CreateDocument(Worker{DocumentID: "bar", Name: "bar"})
+	assert.True(resp.IsOK())
+	assert.Equal(marshals, 1)
+	resp = cdb.ReadDocument("foo")
+	assert.True(resp.IsOK())
+	doc := Worker{}
+	err = resp.Document(&doc)
+	assert.Nil(err)
+	assert.Equal(doc.Age, 42)
+	assert.Equal(unmarshals, 1)
+	doc = Worker{}
+	err = cdb.ReadDocumentInto("foo", &doc)
+	assert.Nil(err)
+	assert.Equal(doc.Age, 42)
+	assert.Equal(unmarshals, 2)
+
+	// Unmarshalling view rows.
+	v, err := cdb.View("testing", "age")
+	assert.NoError(err)
+	assert.Equal(unmarshals, 3)
+	unmarshals = 0
+	err = v.Process(func(id string, key, value, document *couchdb.Unmarshable) error {
+		var age int
+		return key.Unmarshal(&age)
+	})
+	assert.Nil(err)
+	assert.Equal(unmarshals, 1)
+
+	// Unmarshalling found documents to delete.
+	unmarshals = 0
+	statuses, err := cdb.DeleteByFind(couchdb.NewSearch(`{"age": {"$eq": 42}}`))
+	assert.Nil(err)
+	assert.Length(statuses, 1)
+	assert.Equal(unmarshals, 4)
+
+	// Invalid codecs.
+	_, err = couchdb.Open(couchdb.Codec(nil, unmarshal))
+	assert.ErrorMatch(err, ".*invalid codec.*")
+	_, err = couchdb.Open(couchdb.Codec(marshal, nil))
+	assert.ErrorMatch(err, ".*invalid codec.*")
+}
+
+// TestUnusualResponse tests handling server responses with
+// unexpected types for identifier and revision.
+func TestUnusualResponse(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"id": 12345, "rev": null, "_deleted": "yes", "error": 1}`))
+	}))
+	defer srv.Close()
+	address, port := splitHostPort(assert, srv.URL)
+
+	cdb, err := couchdb.Open(couchdb.Host(address, port), couchdb.Name("unusual"))
+	assert.Nil(err)
+
+	resp := cdb.ReadDocument("foo")
+	assert.True(resp.IsOK())
+	assert.Equal(resp.ID(), "")
+	assert.Equal(resp.Revision(), "")
+	assert.False(resp.IsDeleted())
 }
 
 // TestCreateDesignDocument tests creating new design documents.
@@ -76,6 +414,57 @@ func TestCreateDesignDocument(t *testing.T) {
 	assert.Equal(len(designIDsB), len(designIDsA)+2)
 }
 
+// TestDesignNames tests listing the names of design documents
+// and using them for reading.
+func TestDesignNames(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	cdb, cleanup := prepareDatabase(assert, "tmp-design-names")
+	defer cleanup()
+
+	design, err := cdb.Designs().Design("testing")
+	assert.Nil(err)
+	design.SetView("index-a", "function(doc){ emit(doc._id, doc._rev); }", "")
+	resp := design.Write()
+	assert.True(resp.IsOK())
+
+	ids, err := cdb.Designs().IDs()
+	assert.Nil(err)
+	assert.Equal(ids, []string{"_design/testing"})
+	names, err := cdb.Designs().Names()
+	assert.Nil(err)
+	assert.Equal(names, []string{"testing"})
+
+	design, err = cdb.Designs().Design(names[0])
+	assert.Nil(err)
+	_, _, ok := design.View("index-a")
+	assert.True(ok)
+}
+
+// TestHasDesignDocument tests checking the existence of
+// design documents.
+func TestHasDesignDocument(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	cdb, cleanup := prepareDatabase(assert, "tmp-has-design")
+	defer cleanup()
+
+	ok, err := cdb.Designs().Has("testing")
+	assert.Nil(err)
+	assert.False(ok)
+
+	design, err := cdb.Designs().Design("testing")
+	assert.Nil(err)
+	design.SetView("index-a", "function(doc){ emit(doc._id, doc._rev); }", "")
+	resp := design.Write()
+	assert.True(resp.IsOK())
+
+	ok, err = cdb.Designs().Has("testing")
+	assert.Nil(err)
+	assert.True(ok)
+	ok, err = cdb.Designs().Has("other")
+	assert.Nil(err)
+	assert.False(ok)
+}
+
 // TestReadDesignDocument tests reading design documents.
 func TestReadDesignDocument(t *testing.T) {
 	assert := asserts.NewTesting(t, asserts.FailStop)
@@ -95,6 +484,80 @@ func TestReadDesignDocument(t *testing.T) {
 	assert.Equal(designB.ID(), "testing-a")
 }
 
+// TestDesignDocumentOptions tests writing and reading the
+// options of design documents.
+func TestDesignDocumentOptions(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	cdb, cleanup := prepareDatabase(assert, "tmp-design-options")
+	defer cleanup()
+
+	designA, err := cdb.Designs().Design("testing")
+	assert.Nil(err)
+	_, ok := designA.Options()
+	assert.False(ok)
+	assert.True(designA.AutoUpdate())
+	designA.SetView("index-a", "function(doc){ emit(doc._id, doc._rev); }", "")
+	designA.SetOptions(map[string]interface{}{"partitioned": false})
+	designA.SetAutoUpdate(false)
+	resp := designA.Write()
+	assert.True(resp.IsOK())
+
+	designB, err := cdb.Designs().Design("testing")
+	assert.Nil(err)
+	options, ok := designB.Options()
+	assert.True(ok)
+	assert.Equal(options["partitioned"], false)
+	assert.False(designB.AutoUpdate())
+
+	// Remove options and enable autoupdate again.
+	designB.SetOptions(nil)
+	designB.SetAutoUpdate(true)
+	resp = designB.Write()
+	assert.True(resp.IsOK())
+
+	designC, err := cdb.Designs().Design("testing")
+	assert.Nil(err)
+	_, ok = designC.Options()
+	assert.False(ok)
+	assert.True(designC.AutoUpdate())
+}
+
+// TestCopyDesignDocument tests copying design documents.
+func TestCopyDesignDocument(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	cdb, cleanup := prepareFilledDatabase(assert, "tmp-copy-design")
+	defer cleanup()
+
+	mapf := "function(doc){ if (doc._id.indexOf('a') !== -1) { emit(doc._id, doc._rev);  } }"
+	designA, err := cdb.Designs().Design("testing-a")
+	assert.Nil(err)
+	designA.SetView("index-a", mapf, "_count")
+	designA.SetShow("show-a", "function(doc, req){ return doc.name; }")
+	resp := designA.Write()
+	assert.True(resp.IsOK())
+
+	designB, err := cdb.Designs().Copy("testing-a", "testing-b")
+	assert.Nil(err)
+	assert.Equal(designB.ID(), "testing-b")
+
+	designC, err := cdb.Designs().Design("testing-b")
+	assert.Nil(err)
+	mapC, reduceC, ok := designC.View("index-a")
+	assert.True(ok)
+	assert.Equal(mapC, mapf)
+	assert.Equal(reduceC, "_count")
+	_, ok = designC.Show("show-a")
+	assert.True(ok)
+	assert.Equal(designC.Language(), designA.Language())
+
+	// Copy again onto the now existing destination.
+	_, err = cdb.Designs().Copy("testing-a", "testing-b")
+	assert.Nil(err)
+
+	_, err = cdb.Designs().Copy("testing-none", "testing-c")
+	assert.ErrorMatch(err, ".*design document .* not found.*")
+}
+
 // TestUpdateDesignDocument tests updating design documents.
 func TestUpdateDesignDocument(t *testing.T) {
 	assert := asserts.NewTesting(t, asserts.FailStop)
@@ -158,6 +621,109 @@ func TestDeleteDesignDocument(t *testing.T) {
 	assert.Equal(len(designIDsC), len(designIDsA))
 }
 
+// TestValidateDocUpdate tests a design document with
+// a validation function.
+func TestValidateDocUpdate(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	cdb, cleanup := prepareDatabase(assert, "tmp-validate-doc-update")
+	defer cleanup()
+
+	// Create design document with validation.
+	design, err := cdb.Designs().Design("testing")
+	assert.Nil(err)
+	_, ok := design.ValidateDocUpdate()
+	assert.False(ok)
+	design.SetValidateDocUpdate("function(newDoc, oldDoc, userCtx){ if (!newDoc._deleted && !newDoc.name) { throw({forbidden: 'name is missing'}); } }")
+	resp := design.Write()
+	assert.True(resp.IsOK())
+
+	design, err = cdb.Designs().Design("testing")
+	assert.Nil(err)
+	_, ok = design.ValidateDocUpdate()
+	assert.True(ok)
+
+	// Write valid and invalid documents.
+	docA := Worker{
+		DocumentID: "foo-12345",
+		Name:       "foo",
+	}
+	resp = cdb.CreateDocument(docA)
+	assert.True(resp.IsOK())
+
+	docB := Worker{
+		DocumentID: "bar-12345",
+	}
+	resp = cdb.CreateDocument(docB)
+	assert.False(resp.IsOK())
+	assert.Equal(resp.StatusCode(), couchdb.StatusForbidden)
+	assert.ErrorMatch(resp.Error(), ".*name is missing.*")
+}
+
+// TestShow tests executing a show function.
+func TestShow(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	cdb, cleanup := prepareDatabase(assert, "tmp-show")
+	defer cleanup()
+
+	// Create design document with show function and a document.
+	design, err := cdb.Designs().Design("testing")
+	assert.Nil(err)
+	design.SetShow("greeting", "function(doc, req){ return {body: 'Hello, ' + doc.name + '!', headers: {'Content-Type': 'text/plain'}}; }")
+	resp := design.Write()
+	assert.True(resp.IsOK())
+
+	docA := Worker{
+		DocumentID: "foo-12345",
+		Name:       "foo",
+	}
+	resp = cdb.CreateDocument(docA)
+	assert.True(resp.IsOK())
+
+	// Execute the show function.
+	body, contentType, err := cdb.Show("testing", "greeting", "foo-12345")
+	assert.Nil(err)
+	assert.Equal(body.String(), "Hello, foo!")
+	assert.Substring("text/plain", contentType)
+
+	// Show for a non-existing design document.
+	_, _, err = cdb.Show("i-do-not-exist", "greeting", "foo-12345")
+	assert.ErrorMatch(err, ".* 404,.*")
+}
+
+// TestUpdateHandler tests executing an update handler.
+func TestUpdateHandler(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	cdb, cleanup := prepareDatabase(assert, "tmp-update-handler")
+	defer cleanup()
+
+	// Create design document with update handler and a document.
+	design, err := cdb.Designs().Design("testing")
+	assert.Nil(err)
+	design.SetUpdate("increment", "function(doc, req){ if (!doc) { return [null, 'missing']; } doc.counter = (doc.counter || 0) + 1; return [doc, 'incremented']; }")
+	resp := design.Write()
+	assert.True(resp.IsOK())
+
+	docA := map[string]interface{}{
+		"_id":     "counter-12345",
+		"counter": 0,
+	}
+	resp = cdb.CreateDocument(docA)
+	assert.True(resp.IsOK())
+
+	// Execute the handler twice and check the counter.
+	resp = cdb.Update("testing", "increment", "counter-12345", nil)
+	assert.True(resp.IsOK())
+	resp = cdb.Update("testing", "increment", "counter-12345", nil)
+	assert.True(resp.IsOK())
+
+	resp = cdb.ReadDocument("counter-12345")
+	assert.True(resp.IsOK())
+	docB := map[string]interface{}{}
+	err = resp.Document(&docB)
+	assert.Nil(err)
+	assert.Equal(docB["counter"], 2.0)
+}
+
 // TestCreateDocument tests creating new documents.
 func TestCreateDocument(t *testing.T) {
 	assert := asserts.NewTesting(t, asserts.FailStop)
@@ -187,6 +753,195 @@ func TestCreateDocument(t *testing.T) {
 	assert.Equal(id, "bar-12345")
 }
 
+// TestIDGenerator tests creating documents with
+// a custom ID generator.
+func TestIDGenerator(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	counter := 0
+	generator := func() string {
+		counter++
+		return fmt.Sprintf("worker-%05d", counter)
+	}
+	cdb, err := couchdb.Open(couchdb.Name("tmp-id-generator"), couchdb.IDGenerator(generator))
+	assert.Nil(err)
+	cdb.Manager().DeleteDatabase()
+	resp := cdb.Manager().CreateDatabase()
+	assert.True(resp.IsOK())
+	defer cdb.Manager().DeleteDatabase()
+
+	for i := 1; i <= 3; i++ {
+		resp = cdb.CreateDocument(Worker{Name: "foo"})
+		assert.True(resp.IsOK())
+		assert.Equal(resp.ID(), fmt.Sprintf("worker-%05d", i))
+	}
+	assert.Equal(counter, 3)
+
+	// Own IDs don't use the generator.
+	resp = cdb.CreateDocument(Worker{DocumentID: "bar", Name: "bar"})
+	assert.True(resp.IsOK())
+	assert.Equal(resp.ID(), "bar")
+	assert.Equal(counter, 3)
+
+	_, err = couchdb.Open(couchdb.IDGenerator(nil))
+	assert.ErrorMatch(err, ".*invalid ID generator.*")
+}
+
+// TestMapDocument tests creating, updating, and deleting
+// documents based on maps.
+func TestMapDocument(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	cdb, cleanup := prepareDatabase(assert, "tmp-map-document")
+	defer cleanup()
+
+	// Create document without ID.
+	docA := map[string]interface{}{
+		"name": "foo",
+		"age":  50,
+	}
+	resp := cdb.CreateDocument(docA)
+	assert.True(resp.IsOK())
+	id := resp.ID()
+	assert.Match(id, "[0-9a-f]{32}")
+
+	// Create document with ID.
+	docB := map[string]interface{}{
+		"_id":  "bar-12345",
+		"name": "bar",
+		"age":  25,
+	}
+	resp = cdb.CreateDocument(docB)
+	assert.True(resp.IsOK())
+	id = resp.ID()
+	assert.Equal(id, "bar-12345")
+
+	// Read and update it.
+	resp = cdb.ReadDocument(id)
+	assert.True(resp.IsOK())
+	docC := map[string]interface{}{}
+	err := resp.Document(&docC)
+	assert.Nil(err)
+	docC["age"] = 26
+	resp = cdb.UpdateDocument(&docC)
+	assert.True(resp.IsOK())
+	revision := resp.Revision()
+	assert.Substring("2-", revision)
+
+	// Delete it as raw JSON document.
+	docD := json.RawMessage(`{"_id":"bar-12345","_rev":"` + revision + `"}`)
+	resp = cdb.DeleteDocument(docD)
+	assert.True(resp.IsOK())
+
+	// Map without ID cannot be updated.
+	resp = cdb.UpdateDocument(docA)
+	assert.False(resp.IsOK())
+	assert.Equal(resp.StatusCode(), couchdb.StatusBadRequest)
+}
+
+// TestAllDocuments tests iterating over all documents.
+func TestAllDocuments(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	cdb, cleanup := prepareDatabase(assert, "tmp-all-documents")
+	defer cleanup()
+
+	for i := 0; i < 10; i++ {
+		doc := Worker{
+			DocumentID: fmt.Sprintf("worker-%d", i),
+			Name:       fmt.Sprintf("Worker %d", i),
+			Age:        20 + i,
+		}
+		resp := cdb.CreateDocument(doc)
+		assert.True(resp.IsOK())
+	}
+
+	// Iterate over all.
+	count := 0
+	err := cdb.AllDocuments(func(id string, document *couchdb.Unmarshable) error {
+		worker := Worker{}
+		if err := document.Unmarshal(&worker); err != nil {
+			return err
+		}
+		assert.Equal(worker.DocumentID, id)
+		count++
+		return nil
+	})
+	assert.Nil(err)
+	assert.Equal(count, 10)
+
+	// Iterate over a window.
+	ids := []string{}
+	err = cdb.AllDocuments(func(id string, document *couchdb.Unmarshable) error {
+		ids = append(ids, id)
+		return nil
+	}, couchdb.StartKey("worker-3"), couchdb.Limit(3))
+	assert.Nil(err)
+	assert.Equal(ids, []string{"worker-3", "worker-4", "worker-5"})
+}
+
+// TestCountDocuments tests counting documents.
+func TestCountDocuments(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	count := 100
+	cdb, cleanup := prepareDatabase(assert, "tmp-count-documents")
+	defer cleanup()
+
+	// Count all documents.
+	results, err := cdb.BulkWriteDocuments(generateDocuments(count))
+	assert.Nil(err)
+	assert.Length(results, count)
+	n, err := cdb.CountDocuments()
+	assert.Nil(err)
+	assert.Equal(n, count)
+
+	// Count a key range.
+	for i := 0; i < 5; i++ {
+		doc := Worker{
+			DocumentID: fmt.Sprintf("zz-%d", i),
+			Name:       "zz",
+		}
+		resp := cdb.CreateDocument(doc)
+		assert.True(resp.IsOK())
+	}
+	n, err = cdb.CountDocuments(couchdb.StartEndKey("zz-", "zz-\ufff0"))
+	assert.Nil(err)
+	assert.Equal(n, 5)
+	n, err = cdb.CountDocuments()
+	assert.Nil(err)
+	assert.Equal(n, count+5)
+}
+
+// TestCountDocumentsParameters tests that only key parameters
+// lead to counting the rows of a key range.
+func TestCountDocumentsParameters(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(r.URL.Path, "/counting/_all_docs")
+		w.WriteHeader(http.StatusOK)
+		if r.URL.Query().Get("limit") == "0" {
+			w.Write([]byte(`{"total_rows": 1000, "offset": 0, "rows": []}`))
+			return
+		}
+		w.Write([]byte(`{"total_rows": 1000, "offset": 0, "rows": [{"id": "a"}, {"id": "b"}]}`))
+	}))
+	defer srv.Close()
+	address, port := splitHostPort(assert, srv.URL)
+
+	cdb, err := couchdb.Open(couchdb.Host(address, port), couchdb.Name("counting"))
+	assert.Nil(err)
+
+	n, err := cdb.CountDocuments()
+	assert.Nil(err)
+	assert.Equal(n, 1000)
+	n, err = cdb.CountDocuments(couchdb.BasicAuthentication("admin", "admin"))
+	assert.Nil(err)
+	assert.Equal(n, 1000)
+	n, err = cdb.CountDocuments(couchdb.BasicAuthentication("admin", "admin"), couchdb.StartEndKey("a", "b"))
+	assert.Nil(err)
+	assert.Equal(n, 2)
+	n, err = cdb.CountDocuments(couchdb.Keys("a", "b"))
+	assert.Nil(err)
+	assert.Equal(n, 2)
+}
+
 // TestReadDocument tests reading a document.
 func TestReadDocument(t *testing.T) {
 	assert := asserts.NewTesting(t, asserts.FailStop)
@@ -220,6 +975,192 @@ func TestReadDocument(t *testing.T) {
 	assert.ErrorMatch(resp.Error(), ".* 404,.*")
 }
 
+// TestReadDocumentAttachments tests reading a document with
+// attachment stubs or inline attachments.
+func TestReadDocumentAttachments(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	cdb, cleanup := prepareDatabase(assert, "tmp-read-attachments")
+	defer cleanup()
+
+	type Attachment struct {
+		Stub        bool   `json:"stub,omitempty"`
+		ContentType string `json:"content_type"`
+		Length      int    `json:"length,omitempty"`
+		Data        []byte `json:"data,omitempty"`
+		Encoding    string `json:"encoding,omitempty"`
+	}
+	type Document struct {
+		DocumentID       string                `json:"_id"`
+		DocumentRevision string                `json:"_rev,omitempty"`
+		Attachments      map[string]Attachment `json:"_attachments"`
+	}
+	content := []byte(strings.Repeat("Hello, World! ", 100))
+
+	// Create test document with inline attachment.
+	resp := cdb.CreateDocument(Document{
+		DocumentID: "attached",
+		Attachments: map[string]Attachment{
+			"hello.txt": {ContentType: "text/plain", Data: content},
+		},
+	})
+	assert.True(resp.IsOK())
+
+	// Read with stubs only.
+	resp = cdb.ReadDocument("attached")
+	assert.True(resp.IsOK())
+	doc := Document{}
+	err := resp.Document(&doc)
+	assert.Nil(err)
+	att, ok := doc.Attachments["hello.txt"]
+	assert.True(ok)
+	assert.True(att.Stub)
+	assert.Equal(att.Length, len(content))
+	assert.Empty(att.Data)
+
+	// Read with full attachments.
+	resp = cdb.ReadDocument("attached", couchdb.Attachments())
+	assert.True(resp.IsOK())
+	doc = Document{}
+	err = resp.Document(&doc)
+	assert.Nil(err)
+	att = doc.Attachments["hello.txt"]
+	assert.False(att.Stub)
+	assert.Equal(att.Data, content)
+
+	// Read with encoding information, text is compressed.
+	resp = cdb.ReadDocument("attached", couchdb.AttEncodingInfo())
+	assert.True(resp.IsOK())
+	doc = Document{}
+	err = resp.Document(&doc)
+	assert.Nil(err)
+	att = doc.Attachments["hello.txt"]
+	assert.True(att.Stub)
+	assert.Equal(att.Encoding, "gzip")
+}
+
+// TestDocumentRevision tests retrieving the revision of a document.
+func TestDocumentRevision(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	cdb, cleanup := prepareDatabase(assert, "tmp-document-revision")
+	defer cleanup()
+
+	docA := Worker{
+		DocumentID: "foo-12345",
+		Name:       "foo",
+	}
+	resp := cdb.CreateDocument(docA)
+	assert.True(resp.IsOK())
+
+	revision, err := cdb.DocumentRevision("foo-12345")
+	assert.Nil(err)
+	resp = cdb.ReadDocument("foo-12345")
+	assert.True(resp.IsOK())
+	assert.Equal(revision, resp.Revision())
+
+	// Try to get the revision of a non-existent document.
+	_, err = cdb.DocumentRevision("i-do-not-exist")
+	assert.True(failure.Contains(err, "not found"))
+}
+
+// TestReadDocumentInto tests reading a document directly
+// into a value.
+func TestReadDocumentInto(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	cdb, cleanup := prepareDatabase(assert, "tmp-read-document-into")
+	defer cleanup()
+
+	docA := Worker{
+		DocumentID:  "foo-12345",
+		Name:        "foo",
+		Description: strings.Repeat("x", 1024*1024),
+	}
+	resp := cdb.CreateDocument(docA)
+	assert.True(resp.IsOK())
+
+	docB := Worker{}
+	err := cdb.ReadDocumentInto("foo-12345", &docB)
+	assert.Nil(err)
+	assert.Equal(docB.Name, docA.Name)
+	assert.Equal(docB.Description, docA.Description)
+
+	// Try to read non-existent document.
+	err = cdb.ReadDocumentInto("i-do-not-exist", &docB)
+	assert.ErrorMatch(err, ".* 404,.*")
+}
+
+// BenchmarkReadDocument benchmarks reading a large document
+// buffered.
+func BenchmarkReadDocument(b *testing.B) {
+	assert := asserts.NewTesting(b, asserts.FailStop)
+	cdb, cleanup := prepareLargeDocument(assert, "tmp-bench-read-document")
+	defer cleanup()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		doc := Worker{}
+		resp := cdb.ReadDocument("large")
+		assert.Nil(resp.Document(&doc))
+	}
+}
+
+// BenchmarkReadDocumentInto benchmarks reading a large document
+// streamed.
+func BenchmarkReadDocumentInto(b *testing.B) {
+	assert := asserts.NewTesting(b, asserts.FailStop)
+	cdb, cleanup := prepareLargeDocument(assert, "tmp-bench-read-document-into")
+	defer cleanup()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		doc := Worker{}
+		assert.Nil(cdb.ReadDocumentInto("large", &doc))
+	}
+}
+
+// BenchmarkCodec benchmarks decoding all documents in bulk with
+// the default and a configured codec. Here the configured one encodes
+// without HTML escaping and decodes with a json.Decoder, a faster
+// package can be plugged in instead.
+func BenchmarkCodec(b *testing.B) {
+	assert := asserts.NewTesting(b, asserts.FailStop)
+	cdb, cleanup := prepareFilledDatabase(assert, "tmp-bench-codec")
+	defer cleanup()
+	marshal := func(v interface{}) ([]byte, error) {
+		var buf bytes.Buffer
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(v); err != nil {
+			return nil, err
+		}
+		return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+	}
+	unmarshal := func(data []byte, v interface{}) error {
+		return json.NewDecoder(bytes.NewReader(data)).Decode(v)
+	}
+	codecDB, err := couchdb.Open(couchdb.Name("tmp-bench-codec"), couchdb.Codec(marshal, unmarshal))
+	assert.Nil(err)
+
+	decodeAll := func(b *testing.B, db *couchdb.Database) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			err := db.AllDocuments(func(id string, document *couchdb.Unmarshable) error {
+				doc := Worker{}
+				return document.Unmarshal(&doc)
+			})
+			assert.Nil(err)
+		}
+	}
+	b.Run("default", func(b *testing.B) {
+		decodeAll(b, cdb)
+	})
+	b.Run("codec", func(b *testing.B) {
+		decodeAll(b, codecDB)
+	})
+}
+
 // TestUpdateDocument tests updating documents.
 func TestUpdateDocument(t *testing.T) {
 	assert := asserts.NewTesting(t, asserts.FailStop)
@@ -278,6 +1219,51 @@ func TestUpdateDocument(t *testing.T) {
 	assert.True(failure.Contains(resp.Error(), "not found"))
 }
 
+// TestModifyDocument tests modifying documents with retries
+// in case of conflicts.
+func TestModifyDocument(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	cdb, cleanup := prepareDatabase(assert, "tmp-modify-document")
+	defer cleanup()
+
+	docA := Worker{
+		DocumentID: "foo-12345",
+		Name:       "foo",
+		Age:        20,
+	}
+	resp := cdb.CreateDocument(docA)
+	assert.True(resp.IsOK())
+
+	// Modify with a concurrent update during the first attempt.
+	attempts := 0
+	resp = cdb.Modify("foo-12345", func(document *couchdb.Unmarshable) (interface{}, error) {
+		attempts++
+		worker := Worker{}
+		if err := document.Unmarshal(&worker); err != nil {
+			return nil, err
+		}
+		if attempts == 1 {
+			concurrent := worker
+			concurrent.Name = "bar"
+			resp := cdb.UpdateDocument(concurrent)
+			assert.True(resp.IsOK())
+		}
+		worker.Age++
+		return worker, nil
+	})
+	assert.True(resp.IsOK())
+	assert.Equal(attempts, 2)
+
+	resp = cdb.ReadDocument("foo-12345")
+	assert.True(resp.IsOK())
+	docB := Worker{}
+	err := resp.Document(&docB)
+	assert.Nil(err)
+	assert.Equal(docB.Name, "bar")
+	assert.Equal(docB.Age, 21)
+	assert.Substring("3-", docB.DocumentRevision)
+}
+
 // TestDeleteDocument tests deleting a document.
 func TestDeleteDocument(t *testing.T) {
 	assert := asserts.NewTesting(t, asserts.FailStop)
@@ -352,4 +1338,164 @@ func TestDeleteDocumentByID(t *testing.T) {
 	assert.True(failure.Contains(resp.Error(), "not found"))
 }
 
+// TestBulkReadDocuments tests reading documents and their
+// revision histories in bulk.
+func TestBulkReadDocuments(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	cdb, cleanup := prepareDatabase(assert, "tmp-bulk-read")
+	defer cleanup()
+
+	// Create a document with three revisions.
+	doc := Worker{
+		DocumentID: "foo",
+		Name:       "foo",
+		Age:        18,
+	}
+	resp := cdb.CreateDocument(doc)
+	assert.True(resp.IsOK())
+	firstRevision := resp.Revision()
+	for i := 0; i < 2; i++ {
+		resp = cdb.ReadDocument("foo")
+		assert.True(resp.IsOK())
+		err := resp.Document(&doc)
+		assert.Nil(err)
+		doc.Age++
+		resp = cdb.UpdateDocument(doc)
+		assert.True(resp.IsOK())
+	}
+	lastRevision := resp.Revision()
+
+	// Read current and first revision, the missing one, and one
+	// not existing document.
+	brds, err := cdb.BulkReadDocuments([]couchdb.BulkReadRequest{
+		{ID: "foo"},
+		{ID: "foo", Revision: firstRevision},
+		{ID: "foo", Revision: "9-abc"},
+		{ID: "bar"},
+	}, couchdb.Revisions())
+	assert.Nil(err)
+	assert.Length(brds, 4)
+
+	assert.True(brds[0].IsOK())
+	assert.Equal(brds[0].Revision, lastRevision)
+	assert.NotNil(brds[0].History)
+	revisions := brds[0].History.Revisions()
+	assert.Length(revisions, 3)
+	assert.Equal(revisions[0], lastRevision)
+	assert.Equal(revisions[2], firstRevision)
+	current := Worker{}
+	err = brds[0].Document.Unmarshal(&current)
+	assert.Nil(err)
+	assert.Equal(current.Age, 20)
+
+	assert.True(brds[1].IsOK())
+	assert.Equal(brds[1].Revision, firstRevision)
+	assert.Length(brds[1].History.Revisions(), 1)
+
+	assert.False(brds[2].IsOK())
+	assert.Equal(brds[2].Error, "not_found")
+
+	assert.False(brds[3].IsOK())
+	assert.Equal(brds[3].ID, "bar")
+	assert.Equal(brds[3].Error, "not_found")
+}
+
+// TestBulkWriteErrors tests the reporting of failed documents
+// of a bulk writing.
+func TestBulkWriteErrors(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	cdb, cleanup := prepareDatabase(assert, "tmp-bulk-errors")
+	defer cleanup()
+
+	docs := []interface{}{
+		Worker{DocumentID: "foo", Name: "foo"},
+		Worker{DocumentID: "bar", Name: "bar"},
+	}
+	statuses, err := cdb.BulkWriteDocuments(docs)
+	assert.Nil(err)
+	assert.False(statuses.HasErrors())
+	assert.Empty(statuses.Errors())
+
+	// Writing "foo" again without revision conflicts.
+	docs = []interface{}{
+		Worker{DocumentID: "foo", Name: "foo again"},
+		Worker{DocumentID: "baz", Name: "baz"},
+	}
+	statuses, err = cdb.BulkWriteDocuments(docs)
+	assert.Nil(err)
+	assert.Length(statuses, 2)
+	assert.True(statuses.HasErrors())
+	errs := statuses.Errors()
+	assert.Length(errs, 1)
+	assert.ErrorMatch(errs[0], ".*cannot write document 'foo': error 'conflict'.*")
+}
+
+// TestBulkWriteAtomicPayload tests that writing documents in all or
+// nothing mode sets the flag in the payload. A fake server is used as
+// the mode is ignored since CouchDB 2, so the outcome isn't checked.
+func TestBulkWriteAtomicPayload(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	payloads := make(chan map[string]interface{}, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload := map[string]interface{}{}
+		err := json.NewDecoder(r.Body).Decode(&payload)
+		assert.Nil(err)
+		payloads <- payload
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`[{"ok": true, "id": "foo", "rev": "2-abc"}, {"ok": true, "id": "foo", "rev": "2-def"}]`))
+	}))
+	defer srv.Close()
+	address, port := splitHostPort(assert, srv.URL)
+
+	cdb, err := couchdb.Open(couchdb.Host(address, port), couchdb.Name("atomic"))
+	assert.Nil(err)
+
+	// Atomic bulk write sets the mode.
+	docs := []interface{}{
+		Worker{DocumentID: "foo", DocumentRevision: "1-xyz", Name: "one"},
+		Worker{DocumentID: "foo", DocumentRevision: "1-xyz", Name: "two"},
+	}
+	_, err = cdb.BulkWriteAtomic(docs)
+	assert.Nil(err)
+	payload := <-payloads
+	assert.Equal(payload["all_or_nothing"], true)
+	assert.Length(payload["docs"], 2)
+
+	// Normal bulk write doesn't set the mode.
+	_, err = cdb.BulkWriteDocuments(docs)
+	assert.Nil(err)
+	payload = <-payloads
+	_, ok := payload["all_or_nothing"]
+	assert.False(ok)
+}
+
+//--------------------
+// HELPERS
+//--------------------
+
+// prepareLargeDocument prepares a database containing one
+// large document with the ID "large".
+func prepareLargeDocument(assert *asserts.Asserts, name string) (*couchdb.Database, func()) {
+	cdb, cleanup := prepareDatabase(assert, name)
+	doc := Worker{
+		DocumentID:  "large",
+		Name:        "large",
+		Description: strings.Repeat("x", 4*1024*1024),
+	}
+	resp := cdb.CreateDocument(doc)
+	assert.True(resp.IsOK())
+	return cdb, cleanup
+}
+
+// splitHostPort returns address and port of a test server URL.
+func splitHostPort(assert *asserts.Asserts, rawURL string) (string, int) {
+	u, err := url.Parse(rawURL)
+	assert.Nil(err)
+	address, portStr, err := net.SplitHostPort(u.Host)
+	assert.Nil(err)
+	port, err := strconv.Atoi(portStr)
+	assert.Nil(err)
+	return address, port
+}
+
 // EOF
@@ -13,6 +13,9 @@ package couchdb // import "tideland.dev/go/db/couchdb"
 
 import (
 	"encoding/json"
+	"strings"
+
+	"tideland.dev/go/trace/failure"
 )
 
 //--------------------
@@ -74,6 +77,50 @@ func (d *Design) SetLanguage(language string) {
 	d.document.Language = language
 }
 
+// ValidateDocUpdate returns the validation function for document
+// updates if set, otherwise false.
+func (d *Design) ValidateDocUpdate() (string, bool) {
+	if d.document.ValidateDocumentUpdate == "" {
+		return "", false
+	}
+	return d.document.ValidateDocumentUpdate, true
+}
+
+// SetValidateDocUpdate sets the validation function for document
+// updates.
+func (d *Design) SetValidateDocUpdate(validatef string) {
+	d.document.ValidateDocumentUpdate = validatef
+}
+
+// Options returns the options of the design document, e.g.
+// "partitioned", if set, otherwise false.
+func (d *Design) Options() (map[string]interface{}, bool) {
+	if d.document.Options == nil {
+		return nil, false
+	}
+	return d.document.Options, true
+}
+
+// SetOptions sets the options of the design document, e.g.
+// {"partitioned": false} for a global design document inside
+// of a partitioned database. Nil removes them.
+func (d *Design) SetOptions(options map[string]interface{}) {
+	d.document.Options = options
+}
+
+// AutoUpdate returns if the views of the design document are
+// updated automatically. The default is true.
+func (d *Design) AutoUpdate() bool {
+	return d.document.AutoUpdate == nil || *d.document.AutoUpdate
+}
+
+// SetAutoUpdate sets if the views of the design document are
+// updated automatically. Heavy views can be updated only when
+// queried this way.
+func (d *Design) SetAutoUpdate(autoUpdate bool) {
+	d.document.AutoUpdate = &autoUpdate
+}
+
 // View returns the map and the reduce functions of the
 // view with the ID, otherwise false.
 func (d *Design) View(id string) (string, string, bool) {
@@ -119,6 +166,72 @@ func (d *Design) SetShow(id, showf string) {
 	d.document.Shows[id] = showf
 }
 
+// List returns the list function with the ID, otherwise false.
+func (d *Design) List(id string) (string, bool) {
+	if d.document.Lists == nil {
+		d.document.Lists = map[string]string{}
+	}
+	list, ok := d.document.Lists[id]
+	if !ok {
+		return "", false
+	}
+	return list, true
+}
+
+// SetList sets the list function with the ID.
+func (d *Design) SetList(id, listf string) {
+	if d.document.Lists == nil {
+		d.document.Lists = map[string]string{}
+	}
+	d.document.Lists[id] = listf
+}
+
+// Update returns the update handler with the ID, otherwise false.
+func (d *Design) Update(id string) (string, bool) {
+	if d.document.Updates == nil {
+		d.document.Updates = map[string]string{}
+	}
+	update, ok := d.document.Updates[id]
+	if !ok {
+		return "", false
+	}
+	return update, true
+}
+
+// SetUpdate sets the update handler with the ID.
+func (d *Design) SetUpdate(id, updatef string) {
+	if d.document.Updates == nil {
+		d.document.Updates = map[string]string{}
+	}
+	d.document.Updates[id] = updatef
+}
+
+// SearchIndex returns the index function and the analyzer of the
+// full-text search index with the ID, otherwise false.
+func (d *Design) SearchIndex(id string) (string, string, bool) {
+	if d.document.Indexes == nil {
+		d.document.Indexes = designIndexes{}
+	}
+	index, ok := d.document.Indexes[id]
+	if !ok {
+		return "", "", false
+	}
+	return index.Index, index.Analyzer, true
+}
+
+// SetSearchIndex sets the index function and the analyzer of the
+// full-text search index with the ID. An empty analyzer lets the
+// server use its default one.
+func (d *Design) SetSearchIndex(id, indexf, analyzer string) {
+	if d.document.Indexes == nil {
+		d.document.Indexes = designIndexes{}
+	}
+	d.document.Indexes[id] = designIndex{
+		Index:    indexf,
+		Analyzer: analyzer,
+	}
+}
+
 // Write creates a new design document or updates an
 // existing one.
 func (d *Design) Write(params ...Parameter) *ResultSet {
@@ -149,7 +262,9 @@ func newDesigns(db *Database) *Designs {
 	}
 }
 
-// IDs returns the identifiers of all design documents.
+// IDs returns the identifiers of all design documents including
+// the prefix "_design/". Use Names() for identifiers usable with
+// Design().
 func (ds *Designs) IDs() ([]string, error) {
 	jstart, _ := json.Marshal("_design/")
 	jend, _ := json.Marshal("_design0/")
@@ -168,7 +283,26 @@ func (ds *Designs) IDs() ([]string, error) {
 		ids = append(ids, row.ID)
 	}
 	return ids, nil
+}
 
+// Names returns the identifiers of all design documents without
+// the prefix "_design/" like they are used by Design().
+func (ds *Designs) Names() ([]string, error) {
+	ids, err := ds.IDs()
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, id := range ids {
+		names = append(names, strings.TrimPrefix(id, "_design/"))
+	}
+	return names, nil
+}
+
+// Has checks if the design document with the identifier exists
+// without reading it.
+func (ds *Designs) Has(id string) (bool, error) {
+	return ds.db.HasDocument("_design/" + id)
 }
 
 // Design returns one design document by identifier.
@@ -176,6 +310,34 @@ func (ds *Designs) Design(id string) (*Design, error) {
 	return newDesign(ds.db, id)
 }
 
+// Copy reads the design document with the source identifier and
+// writes its content under the destination identifier. An already
+// existing destination is overwritten. Attachments are not copied.
+func (ds *Designs) Copy(srcID, dstID string, params ...Parameter) (*Design, error) {
+	src, err := newDesign(ds.db, srcID)
+	if err != nil {
+		return nil, err
+	}
+	if src.document.Revision == "" {
+		return nil, failure.New("design document %q not found", srcID)
+	}
+	dst, err := newDesign(ds.db, dstID)
+	if err != nil {
+		return nil, err
+	}
+	document := src.document.clone()
+	document.ID = dst.document.ID
+	document.Revision = dst.document.Revision
+	document.Attachments = nil
+	dst.document = document
+	rs := dst.Write(params...)
+	if !rs.IsOK() {
+		return nil, rs.Error()
+	}
+	dst.document.Revision = rs.Revision()
+	return dst, nil
+}
+
 //--------------------
 // DESIGN DOCUMENT
 //--------------------
@@ -188,26 +350,93 @@ type designView struct {
 
 type designViews map[string]designView
 
+// designIndex defines a full-text search index inside a design document.
+type designIndex struct {
+	Index    string `json:"index"`
+	Analyzer string `json:"analyzer,omitempty"`
+}
+
+type designIndexes map[string]designIndex
+
 // designAttachment defines an attachment inside a design document.
 type designAttachment struct {
-	Stub        bool   `json:"stub,omitempty"`
-	ContentType string `json:"content_type,omitempty"`
-	Length      int    `json:"length,omitempty"`
+	Stub          bool   `json:"stub,omitempty"`
+	ContentType   string `json:"content_type,omitempty"`
+	Length        int    `json:"length,omitempty"`
+	Digest        string `json:"digest,omitempty"`
+	RevPos        int    `json:"revpos,omitempty"`
+	Data          []byte `json:"data,omitempty"`
+	Encoding      string `json:"encoding,omitempty"`
+	EncodedLength int    `json:"encoded_length,omitempty"`
 }
 
 type designAttachments map[string]designAttachment
 
 // designDocument contains the data of view design documents.
 type designDocument struct {
-	ID                     string            `json:"_id"`
-	Revision               string            `json:"_rev,omitempty"`
-	Language               string            `json:"language,omitempty"`
-	ValidateDocumentUpdate string            `json:"validate_doc_update,omitempty"`
-	Views                  designViews       `json:"views,omitempty"`
-	Shows                  map[string]string `json:"shows,omitempty"`
-	Attachments            designAttachments `json:"_attachments,omitempty"`
-	Signatures             map[string]string `json:"signatures,omitempty"`
-	Libraries              interface{}       `json:"libs,omitempty"`
+	ID                     string                 `json:"_id"`
+	Revision               string                 `json:"_rev,omitempty"`
+	Language               string                 `json:"language,omitempty"`
+	ValidateDocumentUpdate string                 `json:"validate_doc_update,omitempty"`
+	Options                map[string]interface{} `json:"options,omitempty"`
+	AutoUpdate             *bool                  `json:"autoupdate,omitempty"`
+	Views                  designViews            `json:"views,omitempty"`
+	Indexes                designIndexes          `json:"indexes,omitempty"`
+	Shows                  map[string]string      `json:"shows,omitempty"`
+	Lists                  map[string]string      `json:"lists,omitempty"`
+	Updates                map[string]string      `json:"updates,omitempty"`
+	Attachments            designAttachments      `json:"_attachments,omitempty"`
+	Signatures             map[string]string      `json:"signatures,omitempty"`
+	Libraries              interface{}            `json:"libs,omitempty"`
+}
+
+// clone returns a copy of the design document not sharing
+// its maps with the original.
+func (dd *designDocument) clone() *designDocument {
+	c := *dd
+	if dd.Options != nil {
+		c.Options = make(map[string]interface{}, len(dd.Options))
+		for k, v := range dd.Options {
+			c.Options[k] = v
+		}
+	}
+	if dd.AutoUpdate != nil {
+		autoUpdate := *dd.AutoUpdate
+		c.AutoUpdate = &autoUpdate
+	}
+	if dd.Views != nil {
+		c.Views = make(designViews, len(dd.Views))
+		for k, v := range dd.Views {
+			c.Views[k] = v
+		}
+	}
+	if dd.Indexes != nil {
+		c.Indexes = make(designIndexes, len(dd.Indexes))
+		for k, v := range dd.Indexes {
+			c.Indexes[k] = v
+		}
+	}
+	c.Shows = copyStrings(dd.Shows)
+	c.Lists = copyStrings(dd.Lists)
+	c.Updates = copyStrings(dd.Updates)
+	c.Signatures = copyStrings(dd.Signatures)
+	return &c
+}
+
+//--------------------
+// HELPERS
+//--------------------
+
+// copyStrings returns a copy of the passed map of strings.
+func copyStrings(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
 }
 
 // EOF
@@ -0,0 +1,76 @@
+// Tideland Go Database Clients - CouchDB Client - Internal Unit Tests
+//
+// Copyright (C) 2016-2020 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package couchdb
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"testing"
+
+	"tideland.dev/go/audit/asserts"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestCloneDesignDocument tests that a cloned design document
+// doesn't share its content with the original.
+func TestCloneDesignDocument(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	src := &Design{
+		id: "testing-a",
+		document: &designDocument{
+			ID:       "_design/testing-a",
+			Language: "javascript",
+		},
+	}
+	src.SetOptions(map[string]interface{}{"partitioned": false})
+	src.SetAutoUpdate(false)
+	src.SetView("view-a", "function(doc){ emit(doc._id, null); }", "")
+	src.SetSearchIndex("index-a", "function(doc){ index('name', doc.name); }", "")
+	src.SetShow("show-a", "function(doc, req){ return doc.name; }")
+	src.SetList("list-a", "function(head, req){ return ''; }")
+	src.SetUpdate("update-a", "function(doc, req){ return [doc, ''] }")
+
+	dst := &Design{
+		id:       "testing-b",
+		document: src.document.clone(),
+	}
+	dst.SetView("view-a", "function(doc){ emit(null, null); }", "_count")
+	dst.SetView("view-b", "function(doc){ emit(doc._id, null); }", "")
+	dst.SetSearchIndex("index-b", "function(doc){ index('age', doc.age); }", "")
+	dst.SetShow("show-b", "function(doc, req){ return doc.age; }")
+	dst.SetList("list-b", "function(head, req){ return 'b'; }")
+	dst.SetUpdate("update-b", "function(doc, req){ return [null, ''] }")
+	dst.document.Options["partitioned"] = true
+	*dst.document.AutoUpdate = true
+
+	mapf, reducef, ok := src.View("view-a")
+	assert.True(ok)
+	assert.Equal(mapf, "function(doc){ emit(doc._id, null); }")
+	assert.Equal(reducef, "")
+	_, _, ok = src.View("view-b")
+	assert.False(ok)
+	_, _, ok = src.SearchIndex("index-b")
+	assert.False(ok)
+	_, ok = src.Show("show-b")
+	assert.False(ok)
+	_, ok = src.List("list-b")
+	assert.False(ok)
+	_, ok = src.Update("update-b")
+	assert.False(ok)
+	options, ok := src.Options()
+	assert.True(ok)
+	assert.Equal(options["partitioned"], false)
+	assert.False(src.AutoUpdate())
+}
+
+// EOF
@@ -13,6 +13,9 @@ package couchdb // import "tideland.dev/go/db/couchdb"
 
 import (
 	"encoding/json"
+	"fmt"
+
+	"tideland.dev/go/trace/failure"
 )
 
 //--------------------
@@ -31,6 +34,68 @@ type Status struct {
 // Statuses is the list of status information after a bulk writing.
 type Statuses []Status
 
+// HasErrors returns true if writing at least one document failed.
+func (ss Statuses) HasErrors() bool {
+	for _, s := range ss {
+		if s.Error != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Errors returns the failures of the bulk writing, e.g. conflicts,
+// as errors. It is empty if all documents have been written.
+func (ss Statuses) Errors() []error {
+	errs := []error{}
+	for _, s := range ss {
+		if s.Error != "" {
+			errs = append(errs, failure.New("cannot write document '%s': error '%s', reason '%s'", s.ID, s.Error, s.Reason))
+		}
+	}
+	return errs
+}
+
+// BulkReadRequest identifies one document to read in bulk. An
+// empty revision means the current one.
+type BulkReadRequest struct {
+	ID       string `json:"id"`
+	Revision string `json:"rev,omitempty"`
+}
+
+// RevisionHistory contains the revision history of a document
+// like returned with the parameter Revisions().
+type RevisionHistory struct {
+	Start int      `json:"start"`
+	IDs   []string `json:"ids"`
+}
+
+// Revisions returns the full revisions of the history starting
+// with the newest one.
+func (rh RevisionHistory) Revisions() []string {
+	revisions := make([]string, len(rh.IDs))
+	for i, id := range rh.IDs {
+		revisions[i] = fmt.Sprintf("%d-%s", rh.Start-i, id)
+	}
+	return revisions
+}
+
+// BulkReadDocument is one result of a bulk reading. Missing
+// documents or revisions contain the error and no document.
+type BulkReadDocument struct {
+	ID       string
+	Revision string
+	History  *RevisionHistory
+	Document *Unmarshable
+	Error    string
+	Reason   string
+}
+
+// IsOK returns true if the document has been read.
+func (brd BulkReadDocument) IsOK() bool {
+	return brd.Document != nil
+}
+
 // DatabaseVersionID is used for the database version document.
 const DatabaseVersionID = "database-version"
 
@@ -68,20 +133,78 @@ type Security struct {
 	Members NamesRoles `json:"members,omitempty"`
 }
 
+// Sizes contains the active and external sizes of
+// a database or a partition.
+type Sizes struct {
+	Active   int `json:"active"`
+	External int `json:"external"`
+}
+
+// PartitionInfo contains the information about one
+// partition of a partitioned database.
+type PartitionInfo struct {
+	DatabaseName         string `json:"db_name"`
+	Partition            string `json:"partition"`
+	DocumentCount        int    `json:"doc_count"`
+	DeletedDocumentCount int    `json:"doc_del_count"`
+	Sizes                Sizes  `json:"sizes"`
+}
+
+// SchedulerJobEvent contains one event of the history
+// of a replication job.
+type SchedulerJobEvent struct {
+	Type      string `json:"type"`
+	Timestamp string `json:"timestamp"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// SchedulerJob contains the information about one replication
+// job run by the scheduler.
+type SchedulerJob struct {
+	ID         string                 `json:"id"`
+	Database   string                 `json:"database"`
+	DocumentID string                 `json:"doc_id"`
+	Node       string                 `json:"node"`
+	Source     string                 `json:"source"`
+	Target     string                 `json:"target"`
+	User       string                 `json:"user"`
+	StartTime  string                 `json:"start_time"`
+	History    []SchedulerJobEvent    `json:"history"`
+	Info       map[string]interface{} `json:"info"`
+}
+
+// SchedulerDoc contains the state of one replication
+// document handled by the scheduler.
+type SchedulerDoc struct {
+	ID          string                 `json:"id"`
+	Database    string                 `json:"database"`
+	DocumentID  string                 `json:"doc_id"`
+	Node        string                 `json:"node"`
+	Source      string                 `json:"source"`
+	Target      string                 `json:"target"`
+	State       string                 `json:"state"`
+	ErrorCount  int                    `json:"error_count"`
+	StartTime   string                 `json:"start_time"`
+	LastUpdated string                 `json:"last_updated"`
+	Info        map[string]interface{} `json:"info"`
+}
+
 //--------------------
 // INTERNAL DOCUMENT TYPES
 //--------------------
 
 // couchdbBulkDocuments contains a number of documents added at once.
 type couchdbBulkDocuments struct {
-	Docs     []interface{} `json:"docs"`
-	NewEdits bool          `json:"new_edits,omitempty"`
+	Docs         []interface{} `json:"docs"`
+	NewEdits     bool          `json:"new_edits,omitempty"`
+	AllOrNothing bool          `json:"all_or_nothing,omitempty"`
 }
 
 // couchdbRows returns rows containing IDs of documents. It's
 // part of a view document.
 type couchdbRows struct {
-	Rows []struct {
+	TotalRows int `json:"total_rows"`
+	Rows      []struct {
 		ID string `json:"id"`
 	}
 }
@@ -92,6 +215,12 @@ type couchdbDocumentIDs struct {
 	DocumentIDs []string `json:"doc_ids"`
 }
 
+// couchdbSelector contains a selector expression as body
+// for the according changes filter.
+type couchdbSelector struct {
+	Selector json.RawMessage `json:"selector"`
+}
+
 // couchdbChangesResultChange contains the revision number of one
 // change of one document.
 type couchdbChangesResultChange struct {
@@ -101,7 +230,7 @@ type couchdbChangesResultChange struct {
 // couchdbChangesResult contains one result of a changes feed.
 type couchdbChangesResult struct {
 	ID       string                       `json:"id"`
-	Sequence interface{}                  `json:"seq"`
+	Sequence Sequence                     `json:"seq"`
 	Changes  []couchdbChangesResultChange `json:"changes"`
 	Document json.RawMessage              `json:"doc,omitempty"`
 	Deleted  bool                         `json:"deleted,omitempty"`
@@ -109,7 +238,7 @@ type couchdbChangesResult struct {
 
 // couchdbChanges is a generic result of a CouchDB changes feed.
 type couchdbChanges struct {
-	LastSequence interface{}            `json:"last_seq"`
+	LastSequence Sequence               `json:"last_seq"`
 	Pending      int                    `json:"pending"`
 	Results      []couchdbChangesResult `json:"results"`
 }
@@ -136,10 +265,89 @@ type couchdbView struct {
 	Rows      couchdbViewRows `json:"rows"`
 }
 
+// couchdbSearchRow contains one row of a search index result.
+type couchdbSearchRow struct {
+	ID       string          `json:"id"`
+	Order    json.RawMessage `json:"order"`
+	Fields   json.RawMessage `json:"fields"`
+	Document json.RawMessage `json:"doc"`
+}
+
+// couchdbSearchResult is the result of a search index query.
+type couchdbSearchResult struct {
+	TotalRows int                `json:"total_rows"`
+	Bookmark  string             `json:"bookmark"`
+	Rows      []couchdbSearchRow `json:"rows"`
+}
+
 // couchdbFind is the result of a find command.
 type couchdbFind struct {
-	Warning   string            `json:"warning"`
-	Documents []json.RawMessage `json:"docs"`
+	Warning        string            `json:"warning"`
+	Bookmark       string            `json:"bookmark"`
+	Documents      []json.RawMessage `json:"docs"`
+	ExecutionStats *ExecutionStats   `json:"execution_stats"`
+}
+
+// couchdbBulkRead contains the documents to read at once.
+type couchdbBulkRead struct {
+	Docs []BulkReadRequest `json:"docs"`
+}
+
+// couchdbBulkReadError describes a missing document or revision.
+type couchdbBulkReadError struct {
+	ID       string `json:"id"`
+	Revision string `json:"rev"`
+	Error    string `json:"error"`
+	Reason   string `json:"reason"`
+}
+
+// couchdbBulkReadEntry contains one read revision or the reason
+// why it is missing.
+type couchdbBulkReadEntry struct {
+	OK      json.RawMessage       `json:"ok"`
+	Missing string                `json:"missing"`
+	Error   *couchdbBulkReadError `json:"error"`
+}
+
+// couchdbBulkReadResult contains the revisions read for one document.
+type couchdbBulkReadResult struct {
+	ID   string                 `json:"id"`
+	Docs []couchdbBulkReadEntry `json:"docs"`
+}
+
+// couchdbBulkReadResults is the result of a bulk reading.
+type couchdbBulkReadResults struct {
+	Results []couchdbBulkReadResult `json:"results"`
+}
+
+// couchdbRevisionsDocument contains the internal fields of a
+// document read in bulk.
+type couchdbRevisionsDocument struct {
+	ID        string           `json:"_id"`
+	Revision  string           `json:"_rev"`
+	Revisions *RevisionHistory `json:"_revisions"`
+}
+
+// couchdbDeletedDocument marks a document for deletion
+// in a bulk writing.
+type couchdbDeletedDocument struct {
+	ID       string `json:"_id"`
+	Revision string `json:"_rev"`
+	Deleted  bool   `json:"_deleted"`
+}
+
+// couchdbSchedulerJobs is the result of a scheduler jobs request.
+type couchdbSchedulerJobs struct {
+	TotalRows int            `json:"total_rows"`
+	Offset    int            `json:"offset"`
+	Jobs      []SchedulerJob `json:"jobs"`
+}
+
+// couchdbSchedulerDocs is the result of a scheduler docs request.
+type couchdbSchedulerDocs struct {
+	TotalRows int            `json:"total_rows"`
+	Offset    int            `json:"offset"`
+	Docs      []SchedulerDoc `json:"docs"`
 }
 
 // couchdRoles contains the roles of a user if the
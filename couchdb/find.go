@@ -22,6 +22,7 @@ import (
 // Search allows to formulate what documents shall be selected and the
 // additional parameters.
 type Search struct {
+	partition  string
 	parameters map[string]interface{}
 }
 
@@ -60,6 +61,14 @@ func (s *Search) Sort(fieldsOrDirs ...string) *Search {
 	return s
 }
 
+// SortRaw sets the sorting of the result by a raw Mango sort array,
+// e.g. `[{"address.city": "asc"}, "age"]` for nested fields. It
+// replaces a sorting set by Sort().
+func (s *Search) SortRaw(sort json.RawMessage) *Search {
+	s.parameters["sort"] = sort
+	return s
+}
+
 // Limit sets the maximum number of results returned.
 func (s *Search) Limit(limit int) *Search {
 	s.parameters["limit"] = limit
@@ -112,6 +121,32 @@ func (s *Search) Stable(stable bool) *Search {
 	return s
 }
 
+// ExecutionStats sets whether to return the statistics of the
+// search execution. They are retrieved with Find.ExecutionStats().
+func (s *Search) ExecutionStats(stats bool) *Search {
+	s.parameters["execution_stats"] = stats
+	return s
+}
+
+// Partition restricts the search to the partition with the given
+// name of a partitioned database.
+func (s *Search) Partition(partition string) *Search {
+	s.partition = partition
+	return s
+}
+
+// clone creates a copy of the search.
+func (s *Search) clone() *Search {
+	c := &Search{
+		partition:  s.partition,
+		parameters: make(map[string]interface{}, len(s.parameters)),
+	}
+	for key, value := range s.parameters {
+		c.parameters[key] = value
+	}
+	return c
+}
+
 // MarshalJSON implements json.Marshaler.
 func (s *Search) MarshalJSON() ([]byte, error) {
 	return json.Marshal(s.parameters)
@@ -121,6 +156,16 @@ func (s *Search) MarshalJSON() ([]byte, error) {
 // FINDS
 //--------------------
 
+// ExecutionStats contains the statistics of a search execution,
+// e.g. to investigate slow queries.
+type ExecutionStats struct {
+	TotalKeysExamined       int     `json:"total_keys_examined"`
+	TotalDocsExamined       int     `json:"total_docs_examined"`
+	TotalQuorumDocsExamined int     `json:"total_quorum_docs_examined"`
+	ResultsReturned         int     `json:"results_returned"`
+	ExecutionTimeMs         float64 `json:"execution_time_ms"`
+}
+
 // FindProcessor is a function processing the content of a found document.
 type FindProcessor func(document *Unmarshable) error
 
@@ -132,7 +177,7 @@ type Find struct {
 
 // newFind returns a new finds instance.
 func newFind(db *Database, search *Search, params ...Parameter) (*Find, error) {
-	rs := db.Request().SetPath(db.name, "_find").SetDocument(search).ApplyParameters(params...).Post()
+	rs := db.Request().SetPath(db.name, "_find").SetPartition(search.partition).SetDocument(search).ApplyParameters(params...).Post()
 	if !rs.IsOK() {
 		return nil, rs.Error()
 	}
@@ -152,10 +197,22 @@ func (f *Find) Len() int {
 	return len(f.find.Documents)
 }
 
+// Warning returns the warning of the database, e.g. if no matching
+// index has been found and all documents have been scanned.
+func (f *Find) Warning() string {
+	return f.find.Warning
+}
+
+// ExecutionStats returns the statistics of the search execution
+// if requested with Search.ExecutionStats(), otherwise nil.
+func (f *Find) ExecutionStats() *ExecutionStats {
+	return f.find.ExecutionStats
+}
+
 // Process iterates over the found documents and processes them.
 func (f *Find) Process(process FindProcessor) error {
 	for _, doc := range f.find.Documents {
-		unmarshableDoc := NewUnmarshableJSON(doc)
+		unmarshableDoc := newUnmarshable(f.db, doc)
 		if err := process(unmarshableDoc); err != nil {
 			return err
 		}
@@ -12,6 +12,8 @@ package couchdb_test // import "tideland.dev/go/db/couchdb_test"
 //--------------------
 
 import (
+	"encoding/json"
+	"strings"
 	"testing"
 
 	"tideland.dev/go/audit/asserts"
@@ -80,6 +82,51 @@ func TestLimitedFind(t *testing.T) {
 	assert.Length(fnds, 100)
 }
 
+// TestFindWarning tests the warning for searches
+// without matching index.
+func TestFindWarning(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	cdb, cleanup := prepareFilledDatabase(assert, "find-warning")
+	defer cleanup()
+
+	search := couchdb.NewSearch(`{"age": {"$gt": 30}}`).Limit(5)
+
+	fnds, err := cdb.Find(search)
+	assert.NoError(err)
+	assert.Match(fnds.Warning(), ".*no matching index found.*")
+
+	rs := cdb.Manager().CreateIndex(couchdb.NewIndex("ages", "age"))
+	assert.True(rs.IsOK())
+
+	fnds, err = cdb.Find(search)
+	assert.NoError(err)
+	assert.Equal(fnds.Warning(), "")
+}
+
+// TestFindExecutionStats tests retrieving the statistics
+// of a search execution.
+func TestFindExecutionStats(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	cdb, cleanup := prepareFilledDatabase(assert, "find-execution-stats")
+	defer cleanup()
+
+	// Not requested.
+	search := couchdb.NewSearch(`{"age": {"$gt": 30}}`).Limit(5)
+	fnds, err := cdb.Find(search)
+	assert.NoError(err)
+	assert.Nil(fnds.ExecutionStats())
+
+	// Requested, without index all documents are examined.
+	search = search.ExecutionStats(true)
+	fnds, err = cdb.Find(search)
+	assert.NoError(err)
+	stats := fnds.ExecutionStats()
+	assert.NotNil(stats)
+	assert.Equal(stats.ResultsReturned, fnds.Len())
+	assert.True(stats.TotalDocsExamined >= fnds.Len())
+	assert.True(stats.ExecutionTimeMs >= 0.0)
+}
+
 // TestSortedFind tests retrieving a larger number in a sorted way.
 func TestSortedFind(t *testing.T) {
 	assert := asserts.NewTesting(t, asserts.FailStop)
@@ -107,6 +154,38 @@ func TestSortedFind(t *testing.T) {
 	assert.Nil(err)
 }
 
+// TestRawSortedFind tests passing a raw sort specification.
+func TestRawSortedFind(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+
+	sort := `[{"address.city":"asc"},{"name":"desc"},"age"]`
+	search := couchdb.NewSearch(`{"address.city": {"$gt": ""}}`).Sort("name", "asc").SortRaw(json.RawMessage(sort))
+	body, err := json.Marshal(search)
+	assert.Nil(err)
+	assert.Substring(`"sort":`+sort, string(body))
+
+	cdb, cleanup := prepareFilledDatabase(assert, "find-raw-sorted")
+	defer cleanup()
+
+	// Sorting field has to be part of selector.
+	search = couchdb.NewSearch(`{"name": {"$gt": ""}, "active": {"$eq": true}}`).SortRaw(json.RawMessage(`[{"name": "desc"}]`)).Limit(100)
+	fnds, err := cdb.Find(search)
+	assert.NoError(err)
+	name := "~"
+	err = fnds.Process(func(document *couchdb.Unmarshable) error {
+		fields := struct {
+			Name string `json:"name"`
+		}{}
+		if err := document.Unmarshal(&fields); err != nil {
+			return err
+		}
+		assert.True(fields.Name <= name)
+		name = fields.Name
+		return nil
+	})
+	assert.Nil(err)
+}
+
 // TestFindExists tests calling find with an exists selector.
 func TestFindExists(t *testing.T) {
 	assert := asserts.NewTesting(t, asserts.FailStop)
@@ -193,4 +272,117 @@ func TestMatches(t *testing.T) {
 	assert.Nil(err)
 }
 
+// TestDeleteByFind tests deleting all found documents.
+func TestDeleteByFind(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	cdb, cleanup := prepareFilledDatabase(assert, "find-delete")
+	defer cleanup()
+
+	search := couchdb.NewSearch(`{"active": {"$eq": false}}`).Limit(1000)
+	fnds, err := cdb.Find(search)
+	assert.NoError(err)
+	inactive := fnds.Len()
+	assert.True(inactive > 25)
+
+	// Delete with smaller pages.
+	statuses, err := cdb.DeleteByFind(couchdb.NewSearch(`{"active": {"$eq": false}}`).Limit(25))
+	assert.NoError(err)
+	assert.Length(statuses, inactive)
+	for _, status := range statuses {
+		assert.True(status.OK)
+	}
+
+	fnds, err = cdb.Find(search)
+	assert.NoError(err)
+	assert.Length(fnds, 0)
+}
+
+// TestPartialFilterIndex tests finding with an index using
+// a partial filter.
+func TestPartialFilterIndex(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	cdb, cleanup := prepareFilledDatabase(assert, "find-partial-filter")
+	defer cleanup()
+
+	idx := couchdb.NewIndex("active-ages", "age").PartialFilter(`{"active": {"$eq": true}}`)
+	rs := cdb.Manager().CreateIndex(idx)
+	assert.True(rs.IsOK())
+	designID := rs.ID()
+
+	// Explain the search to check the used index.
+	search := couchdb.NewSearch(`{"age": {"$gt": 30}, "active": {"$eq": true}}`).UseIndex(designID, "active-ages")
+	rs = cdb.Request().SetPath(cdb.Name(), "_explain").SetDocument(search).Post()
+	assert.True(rs.IsOK())
+	explain := struct {
+		Index struct {
+			Name string `json:"name"`
+		} `json:"index"`
+	}{}
+	err := rs.Document(&explain)
+	assert.Nil(err)
+	assert.Equal(explain.Index.Name, "active-ages")
+
+	// Find with it.
+	fnds, err := cdb.Find(search)
+	assert.NoError(err)
+	err = fnds.Process(func(document *couchdb.Unmarshable) error {
+		worker := Worker{}
+		if err := document.Unmarshal(&worker); err != nil {
+			return err
+		}
+		assert.True(worker.Age > 30 && worker.Active)
+		return nil
+	})
+	assert.Nil(err)
+}
+
+// TestPartitionFind tests finding and viewing documents of
+// one partition.
+func TestPartitionFind(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	cdb, err := couchdb.Open(couchdb.Name("find-partition"))
+	assert.NoError(err)
+	cdb.Manager().DeleteDatabase()
+	rs := cdb.Manager().CreateDatabase(couchdb.Partitioned())
+	assert.True(rs.IsOK())
+	defer func() { cdb.Manager().DeleteDatabase() }()
+
+	for i, id := range []string{"a:1", "a:2", "a:3", "b:1", "b:2"} {
+		doc := Worker{
+			DocumentID: id,
+			Name:       id,
+			Age:        20 + i,
+			Active:     true,
+		}
+		rs = cdb.CreateDocument(doc)
+		assert.True(rs.IsOK())
+	}
+
+	// Find in one partition.
+	search := couchdb.NewSearch(`{"active": {"$eq": true}}`).Partition("a")
+	fnds, err := cdb.Find(search)
+	assert.NoError(err)
+	assert.Length(fnds, 3)
+	err = fnds.Process(func(document *couchdb.Unmarshable) error {
+		worker := Worker{}
+		if err := document.Unmarshal(&worker); err != nil {
+			return err
+		}
+		assert.True(strings.HasPrefix(worker.DocumentID, "a:"))
+		return nil
+	})
+	assert.Nil(err)
+
+	// View of one partition.
+	design, err := cdb.Designs().Design("testing")
+	assert.Nil(err)
+	design.SetView("age", "function(doc){ emit(doc.age, doc.name); }", "")
+	rs = design.Write()
+	assert.True(rs.IsOK())
+
+	v, err := cdb.View("testing", "age", couchdb.Partition("b"))
+	assert.NoError(err)
+	assert.Equal(v.ReturnedRows(), 2)
+}
+
 // EOF
@@ -84,17 +84,40 @@ func (steps Steps) execute(db *Database) error {
 
 // Index allows to generate an index for faster find operations.
 type Index struct {
-	name       string
-	parameters map[string]interface{}
+	name        string
+	indexType   string
+	fields      []string
+	typedFields []map[string]string
+	parameters  map[string]interface{}
 }
 
 // NewIndex creates an index.
 func NewIndex(name string, fields ...string) *Index {
 	idx := &Index{
 		name:       name,
+		indexType:  "json",
+		fields:     fields,
 		parameters: make(map[string]interface{}),
 	}
-	idx.parameters["fields"] = fields
+	return idx
+}
+
+// Type sets the type of the index, "json" or "text". The
+// default is "json". Full-text indexes of type "text" need a
+// search enabled CouchDB.
+func (idx *Index) Type(indexType string) *Index {
+	idx.indexType = indexType
+	return idx
+}
+
+// TypedField adds a field with its type "string", "number", or
+// "boolean" to an index of type "text". Fields passed to NewIndex()
+// are of type "string" in this case.
+func (idx *Index) TypedField(name, fieldType string) *Index {
+	idx.typedFields = append(idx.typedFields, map[string]string{
+		"name": name,
+		"type": fieldType,
+	})
 	return idx
 }
 
@@ -104,6 +127,14 @@ func (idx *Index) Selector(selector string) *Index {
 	return idx
 }
 
+// PartialFilter restricts the indexed documents to those matching
+// the selector. Finds have to address the index explicitly with
+// Search.UseIndex() to use it.
+func (idx *Index) PartialFilter(selector string) *Index {
+	idx.parameters["partial_filter_selector"] = json.RawMessage(selector)
+	return idx
+}
+
 // Sort sets the sorting of the index by alternates of field names
 // and directions like "asc" or "desc". For examle ("name", "asc",
 // "age", "desc").
@@ -138,10 +169,26 @@ func (idx *Index) Skip(skip int) *Index {
 
 // MarshalJSON implements json.Marshaler.
 func (idx *Index) MarshalJSON() ([]byte, error) {
+	parameters := make(map[string]interface{}, len(idx.parameters)+1)
+	for key, value := range idx.parameters {
+		parameters[key] = value
+	}
+	if idx.indexType == "text" {
+		fields := []map[string]string{}
+		for _, field := range idx.fields {
+			fields = append(fields, map[string]string{
+				"name": field,
+				"type": "string",
+			})
+		}
+		parameters["fields"] = append(fields, idx.typedFields...)
+	} else {
+		parameters["fields"] = idx.fields
+	}
 	doc := map[string]interface{}{
 		"name":  idx.name,
-		"index": idx.parameters,
-		"type":  "json",
+		"index": parameters,
+		"type":  idx.indexType,
 	}
 	return json.Marshal(doc)
 }
@@ -223,9 +270,10 @@ func (m *Manager) Init(steps ...Step) error {
 }
 
 // AllDatabaseIDs returns a list of all database IDs
-// of the connected server.
-func (m *Manager) AllDatabaseIDs() ([]string, error) {
-	rs := m.db.Request().SetPath("_all_dbs").Get()
+// of the connected server. Parameters like StartKey, EndKey,
+// or Limit allow to restrict the list.
+func (m *Manager) AllDatabaseIDs(params ...Parameter) ([]string, error) {
+	rs := m.db.Request().SetPath("_all_dbs").ApplyParameters(params...).Get()
 	if !rs.IsOK() {
 		return nil, rs.Error()
 	}
@@ -237,6 +285,21 @@ func (m *Manager) AllDatabaseIDs() ([]string, error) {
 	return ids, nil
 }
 
+// AllDatabaseIDsPaged returns a window of database IDs starting
+// with the given key and containing at most limit IDs. An empty
+// start key begins with the first database, a limit of zero or
+// less returns all following ones.
+func (m *Manager) AllDatabaseIDsPaged(startKey string, limit int) ([]string, error) {
+	params := []Parameter{}
+	if startKey != "" {
+		params = append(params, StartKey(startKey))
+	}
+	if limit > 0 {
+		params = append(params, Limit(limit))
+	}
+	return m.AllDatabaseIDs(params...)
+}
+
 // HasDatabase checks if the configured database exists.
 func (m *Manager) HasDatabase() (bool, error) {
 	rs := m.db.Request().SetPath(m.db.name).Head()
@@ -264,6 +327,57 @@ func (m *Manager) DeleteNamedDatabase(name string, params ...Parameter) *ResultS
 	return m.db.Request().SetPath(name).ApplyParameters(params...).Delete()
 }
 
+// RevsLimit returns the maximum number of document revisions
+// the configured database stores.
+func (m *Manager) RevsLimit(params ...Parameter) (int, error) {
+	rs := m.db.Request().SetPath(m.db.name, "_revs_limit").ApplyParameters(params...).Get()
+	if !rs.IsOK() {
+		return 0, rs.Error()
+	}
+	var limit int
+	err := rs.Document(&limit)
+	if err != nil {
+		return 0, err
+	}
+	return limit, nil
+}
+
+// SetRevsLimit sets the maximum number of document revisions
+// the configured database stores.
+func (m *Manager) SetRevsLimit(limit int, params ...Parameter) *ResultSet {
+	return m.db.Request().SetPath(m.db.name, "_revs_limit").SetDocument(limit).ApplyParameters(params...).Put()
+}
+
+// SchedulerJobs returns the replication jobs currently
+// run by the scheduler.
+func (m *Manager) SchedulerJobs(params ...Parameter) ([]SchedulerJob, error) {
+	rs := m.db.Request().SetPath("_scheduler", "jobs").ApplyParameters(params...).Get()
+	if !rs.IsOK() {
+		return nil, rs.Error()
+	}
+	jobs := couchdbSchedulerJobs{}
+	err := rs.Document(&jobs)
+	if err != nil {
+		return nil, err
+	}
+	return jobs.Jobs, nil
+}
+
+// SchedulerDocs returns the states of the replication documents
+// handled by the scheduler.
+func (m *Manager) SchedulerDocs(params ...Parameter) ([]SchedulerDoc, error) {
+	rs := m.db.Request().SetPath("_scheduler", "docs").ApplyParameters(params...).Get()
+	if !rs.IsOK() {
+		return nil, rs.Error()
+	}
+	docs := couchdbSchedulerDocs{}
+	err := rs.Document(&docs)
+	if err != nil {
+		return nil, err
+	}
+	return docs.Docs, nil
+}
+
 // CreateIndex creates a new index for finds.
 func (m *Manager) CreateIndex(index *Index, params ...Parameter) *ResultSet {
 	return m.db.Request().SetPath(m.db.name, "_index").SetDocument(index).ApplyParameters(params...).Post()
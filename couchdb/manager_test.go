@@ -12,7 +12,13 @@ package couchdb_test // import "tideland.dev/go/db/couchdb_test"
 //--------------------
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
+	"time"
 
 	"tideland.dev/go/audit/asserts"
 	"tideland.dev/go/db/couchdb"
@@ -125,6 +131,25 @@ func TestAllDatabaseIDs(t *testing.T) {
 	assert.NoError(err)
 	_, err = cdb.Manager().AllDatabaseIDs()
 	assert.NoError(err)
+
+	// Create some databases to page through.
+	names := []string{"tmp-paged-a", "tmp-paged-b", "tmp-paged-c"}
+	for _, name := range names {
+		pcdb, err := couchdb.Open(couchdb.Name(name))
+		assert.NoError(err)
+		pcdb.Manager().DeleteDatabase()
+		rs := pcdb.Manager().CreateDatabase()
+		assert.True(rs.IsOK())
+		defer pcdb.Manager().DeleteDatabase()
+	}
+
+	ids, err := cdb.Manager().AllDatabaseIDsPaged("tmp-paged-a", 2)
+	assert.NoError(err)
+	assert.Equal(ids, []string{"tmp-paged-a", "tmp-paged-b"})
+
+	ids, err = cdb.Manager().AllDatabaseIDs(couchdb.StartEndKey("tmp-paged-b", "tmp-paged-c"))
+	assert.NoError(err)
+	assert.Equal(ids, []string{"tmp-paged-b", "tmp-paged-c"})
 }
 
 // TestCreateDeleteDatabase tests the creation and deletion
@@ -155,6 +180,96 @@ func TestCreateDeleteDatabase(t *testing.T) {
 	assert.False(has)
 }
 
+// TestPartitionedDatabase tests the creation of a partitioned
+// database and reading partition information.
+func TestPartitionedDatabase(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+
+	cdb, err := couchdb.Open(couchdb.Name("tmp-partitioned"))
+	assert.NoError(err)
+	cdb.Manager().DeleteDatabase()
+	rs := cdb.Manager().CreateDatabase(couchdb.Partitioned())
+	assert.True(rs.IsOK())
+	defer func() { cdb.Manager().DeleteDatabase() }()
+
+	// Add documents to two partitions.
+	for i, id := range []string{"a:1", "a:2", "a:3", "b:1"} {
+		doc := Worker{
+			DocumentID: id,
+			Name:       id,
+			Age:        20 + i,
+		}
+		rs = cdb.CreateDocument(doc)
+		assert.True(rs.IsOK())
+	}
+
+	// Read partition info.
+	info, err := cdb.PartitionInfo("a")
+	assert.NoError(err)
+	assert.Equal(info.Partition, "a")
+	assert.Equal(info.DocumentCount, 3)
+
+	info, err = cdb.PartitionInfo("b")
+	assert.NoError(err)
+	assert.Equal(info.DocumentCount, 1)
+}
+
+// TestRevsLimit tests setting and reading the revision limit.
+func TestRevsLimit(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	cdb, cleanup := prepareDatabase(assert, "revs-limit")
+	defer cleanup()
+
+	limit, err := cdb.Manager().RevsLimit()
+	assert.NoError(err)
+	assert.Equal(limit, 1000)
+
+	rs := cdb.Manager().SetRevsLimit(25)
+	assert.True(rs.IsOK())
+
+	limit, err = cdb.Manager().RevsLimit()
+	assert.NoError(err)
+	assert.Equal(limit, 25)
+}
+
+// TestScheduler tests the inspection of the replication scheduler.
+func TestScheduler(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+
+	cdb, err := couchdb.Open(couchdb.Name(testDB))
+	assert.NoError(err)
+
+	jobs, err := cdb.Manager().SchedulerJobs()
+	assert.NoError(err)
+	for _, job := range jobs {
+		assert.True(job.Source != "")
+		assert.True(job.Target != "")
+	}
+
+	docs, err := cdb.Manager().SchedulerDocs(couchdb.Limit(10))
+	assert.NoError(err)
+	assert.True(len(docs) <= 10)
+	for _, doc := range docs {
+		assert.True(doc.State != "")
+	}
+}
+
+// TestIndexMarshalling tests the marshalling of indexes
+// of the different types.
+func TestIndexMarshalling(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+
+	idx := couchdb.NewIndex("names", "name", "age")
+	b, err := json.Marshal(idx)
+	assert.NoError(err)
+	assert.Equal(string(b), `{"index":{"fields":["name","age"]},"name":"names","type":"json"}`)
+
+	idx = couchdb.NewIndex("names", "name").Type("text").TypedField("age", "number")
+	b, err = json.Marshal(idx)
+	assert.NoError(err)
+	assert.Equal(string(b), `{"index":{"fields":[{"name":"name","type":"string"},{"name":"age","type":"number"}]},"name":"names","type":"text"}`)
+}
+
 // TestAdministraotor tests the administrator related functions.
 func TestAdministrator(t *testing.T) {
 	assert := asserts.NewTesting(t, asserts.FailStop)
@@ -209,6 +324,136 @@ func TestAdministrator(t *testing.T) {
 	assert.False(ok)
 }
 
+// TestCredentials tests the basic authentication configured
+// when opening the database.
+func TestCredentials(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	cdb, cleanup := prepareDatabase(assert, "credentials")
+	defer cleanup()
+
+	err := cdb.Manager().WriteAdministrator("nonode@nohost", "admin", "admin")
+	assert.NoError(err)
+	defer func() {
+		err := cdb.Manager().DeleteAdministrator("nonode@nohost", "admin", couchdb.BasicAuthentication("admin", "admin"))
+		assert.NoError(err)
+	}()
+
+	// Without credentials.
+	ok, err := cdb.Manager().HasAdministrator("nonode@nohost", "admin")
+	assert.ErrorMatch(err, ".*status code 401.*")
+	assert.False(ok)
+
+	// With credentials.
+	acdb, err := couchdb.Open(couchdb.Name("credentials"), couchdb.Credentials("admin", "admin"))
+	assert.NoError(err)
+	ok, err = acdb.Manager().HasAdministrator("nonode@nohost", "admin")
+	assert.NoError(err)
+	assert.True(ok)
+
+	// Explicit parameter overrides credentials.
+	ok, err = acdb.Manager().HasAdministrator("nonode@nohost", "admin", couchdb.BasicAuthentication("admin", "wrong"))
+	assert.ErrorMatch(err, ".*status code 401.*")
+	assert.False(ok)
+}
+
+// TestAuthenticatedSession tests the session authenticating
+// again after it expired on the server.
+func TestAuthenticatedSession(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	var mu sync.Mutex
+	logins := 0
+	valid := ""
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/_session" {
+			logins++
+			valid = fmt.Sprintf("AuthSession=session-%d", logins)
+			w.Header().Set("Set-Cookie", valid+"; Version=1; Path=/; HttpOnly")
+			w.Write([]byte(`{"ok":true,"name":"admin","roles":["_admin"]}`))
+			return
+		}
+		if r.Header.Get("Cookie") != valid {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"unauthorized","reason":"session expired"}`))
+			return
+		}
+		w.Write([]byte(`"admin"`))
+	}))
+	defer srv.Close()
+	address, port := splitHostPort(assert, srv.URL)
+	cdb, err := couchdb.Open(couchdb.Host(address, port))
+	assert.NoError(err)
+
+	session, err := cdb.AuthenticatedSession("admin", "admin")
+	assert.NoError(err)
+
+	// Valid session needs no refresh.
+	ok, err := cdb.Manager().HasAdministrator("nonode@nohost", "admin", session.Cookie())
+	assert.NoError(err)
+	assert.True(ok)
+	assert.Equal(session.Refreshes(), 0)
+
+	// Session expired on the server, request is retried
+	// after authenticating again.
+	mu.Lock()
+	valid = ""
+	mu.Unlock()
+	ok, err = cdb.Manager().HasAdministrator("nonode@nohost", "admin", session.Cookie())
+	assert.NoError(err)
+	assert.True(ok)
+	assert.Equal(session.Refreshes(), 1)
+	mu.Lock()
+	assert.Equal(logins, 2)
+	mu.Unlock()
+
+	// Refreshed session is used directly.
+	ok, err = cdb.Manager().HasAdministrator("nonode@nohost", "admin", session.Cookie())
+	assert.NoError(err)
+	assert.True(ok)
+	assert.Equal(session.Refreshes(), 1)
+}
+
+// TestSessionExpiration tests the retrieving of the session
+// expiration out of the cookie attributes.
+func TestSessionExpiration(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	setCookie := ""
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", setCookie)
+		w.Write([]byte(`{"ok":true,"name":"admin","roles":["_admin"]}`))
+	}))
+	defer srv.Close()
+	address, port := splitHostPort(assert, srv.URL)
+	cdb, err := couchdb.Open(couchdb.Host(address, port))
+	assert.NoError(err)
+
+	// Relative expiration.
+	setCookie = "AuthSession=YWRtaW4; Version=1; Path=/; Max-Age=300; HttpOnly"
+	start := time.Now()
+	session, err := cdb.StartSession("admin", "admin")
+	assert.NoError(err)
+	assert.True(session.ExpiresAt().After(start.Add(299 * time.Second)))
+	assert.True(session.ExpiresAt().Before(time.Now().Add(301 * time.Second)))
+
+	// Absolute expiration.
+	expires := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	setCookie = "AuthSession=YWRtaW4; Version=1; Path=/; Expires=" + expires.Format(http.TimeFormat) + "; HttpOnly"
+	session, err = cdb.StartSession("admin", "admin")
+	assert.NoError(err)
+	assert.True(session.ExpiresAt().Equal(expires))
+
+	// Default expiration.
+	setCookie = "AuthSession=YWRtaW4; Version=1; Path=/; HttpOnly"
+	start = time.Now()
+	session, err = cdb.StartSession("admin", "admin")
+	assert.NoError(err)
+	assert.True(session.ExpiresAt().After(start.Add(599 * time.Second)))
+	assert.True(session.ExpiresAt().Before(time.Now().Add(601 * time.Second)))
+}
+
 // TestUser tests the user management related functions.
 func TestUser(t *testing.T) {
 	assert := asserts.NewTesting(t, asserts.FailStop)
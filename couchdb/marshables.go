@@ -12,6 +12,7 @@ package couchdb // import "tideland.dev/go/db/couchdb"
 //--------------------
 
 import (
+	"bytes"
 	"encoding/json"
 
 	"tideland.dev/go/trace/failure"
@@ -25,7 +26,8 @@ import (
 // can be unmarshalled into a given variable. It is used to
 // access key, value, or document of view result rows.
 type Unmarshable struct {
-	message json.RawMessage
+	message   json.RawMessage
+	unmarshal func(data []byte, v interface{}) error
 }
 
 // NewUnmarshableRaw creates a new Unmarshable out of
@@ -42,6 +44,22 @@ func NewUnmarshableJSON(msg json.RawMessage) *Unmarshable {
 	}
 }
 
+// IsNil returns true if the unmarshable contains no message at all,
+// e.g. the document of a view row requested without IncludeDocuments().
+// A JSON null is a message, so that both cases can be distinguished.
+func (u *Unmarshable) IsNil() bool {
+	return u == nil || len(u.message) == 0
+}
+
+// newUnmarshable creates a new Unmarshable using the codec
+// of the database.
+func newUnmarshable(db *Database, msg json.RawMessage) *Unmarshable {
+	return &Unmarshable{
+		message:   msg,
+		unmarshal: db.unmarshal,
+	}
+}
+
 // String returns the unmarshable as string.
 func (u *Unmarshable) String() string {
 	if u.message == nil {
@@ -62,11 +80,37 @@ func (u *Unmarshable) Raw() []byte {
 
 // Unmarshal unmarshals the interface into the passed variable.
 func (u *Unmarshable) Unmarshal(doc interface{}) error {
-	err := json.Unmarshal(u.message, doc)
+	err := unmarshalWith(u.unmarshal, u.message, doc)
+	if err != nil {
+		return failure.Annotate(err, "cannot unmarshal database document")
+	}
+	return nil
+}
+
+// UnmarshalWithNumbers unmarshals the interface into the passed
+// variable like Unmarshal, but numbers inside of interface values
+// are kept as json.Number instead of float64 to not lose precision.
+func (u *Unmarshable) UnmarshalWithNumbers(doc interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(u.message))
+	decoder.UseNumber()
+	err := decoder.Decode(doc)
 	if err != nil {
 		return failure.Annotate(err, "cannot unmarshal database document")
 	}
 	return nil
 }
 
+//--------------------
+// HELPERS
+//--------------------
+
+// unmarshalWith unmarshals the data with the passed function of
+// a configured codec or with encoding/json if it is nil.
+func unmarshalWith(unmarshal func(data []byte, v interface{}) error, data []byte, v interface{}) error {
+	if unmarshal == nil {
+		return json.Unmarshal(data, v)
+	}
+	return unmarshal(data, v)
+}
+
 // EOF
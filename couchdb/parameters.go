@@ -27,6 +27,9 @@ const (
 
 	StyleMainOnly = "main_only"
 	StyleAllDocs  = "all_docs"
+
+	StaleOK          = "ok"
+	StaleUpdateAfter = "update_after"
 )
 
 //--------------------
@@ -67,6 +70,22 @@ func Revision(revision string) Parameter {
 	}
 }
 
+// Revisions sets the flag for including the revision history of
+// read documents as "_revisions".
+func Revisions() Parameter {
+	return func(req *Request) {
+		req.SetQuery("revs", "true")
+	}
+}
+
+// Latest sets the flag for reading the latest leaf revisions
+// instead of the requested ones.
+func Latest() Parameter {
+	return func(req *Request) {
+		req.SetQuery("latest", "true")
+	}
+}
+
 // Limit sets the maximum number of result rows.
 func Limit(limit int) Parameter {
 	return func(req *Request) {
@@ -143,7 +162,14 @@ func FilterDocumentIDs(documentIDs ...string) Parameter {
 // FilterSelector sets the filter to the passed selector expression.
 func FilterSelector(selector json.RawMessage) Parameter {
 	update := func(doc interface{}) interface{} {
-		// TODO 2020-03-31 Mue Set selector expression.
+		if doc == nil {
+			doc = &couchdbSelector{}
+		}
+		sdoc, ok := doc.(*couchdbSelector)
+		if ok {
+			sdoc.Selector = selector
+			return sdoc
+		}
 		return doc
 	}
 	return func(req *Request) {
@@ -161,14 +187,26 @@ func FilterView(view string) Parameter {
 	}
 }
 
+// Partitioned sets the flag for the creation of a partitioned database.
+func Partitioned() Parameter {
+	return func(req *Request) {
+		req.SetQuery("partitioned", "true")
+	}
+}
+
+// Partition restricts a request, e.g. of a view or a find, to the
+// partition with the given name.
+func Partition(partition string) Parameter {
+	return func(req *Request) {
+		req.SetPartition(partition)
+	}
+}
+
 // BasicAuthentication is intended for basic authentication
 // against the database.
 func BasicAuthentication(name, password string) Parameter {
 	return func(req *Request) {
-		np := []byte(name + ":" + password)
-		auth := "Basic " + base64.StdEncoding.EncodeToString(np)
-
-		req.SetHeader("Authorization", auth)
+		req.SetHeader("Authorization", basicAuthorization(name, password))
 	}
 }
 
@@ -251,11 +289,73 @@ func Group(level int) Parameter {
 	}
 }
 
-// IncludeDocuments sets the flag for the including of found view documents.
+// Stale allows view results which are possibly not up to date. The
+// mode StaleOK returns them without updating the view, StaleUpdateAfter
+// updates the view after returning them. As the stale parameter is
+// deprecated by CouchDB it is mapped to the update and stable
+// parameters. Default are fresh results.
+func Stale(mode string) Parameter {
+	return func(req *Request) {
+		switch mode {
+		case StaleOK:
+			req.SetQuery("update", "false")
+			req.SetQuery("stable", "true")
+		case StaleUpdateAfter:
+			req.SetQuery("update", "lazy")
+			req.SetQuery("stable", "true")
+		}
+	}
+}
+
+// UpdateView sets if the view shall be updated before returning
+// the results. Default is true.
+func UpdateView(update bool) Parameter {
+	return func(req *Request) {
+		req.SetQuery("update", strconv.FormatBool(update))
+	}
+}
+
+// IncludeDocuments sets the flag for the including of found view
+// documents. It also works for the documents of changes.
 func IncludeDocuments() Parameter {
 	return func(req *Request) {
 		req.SetQuery("include_docs", "true")
 	}
 }
 
+// Attachments sets the flag for including the attachments of a read
+// document inline and base64 encoded instead of only their stubs.
+func Attachments() Parameter {
+	return func(req *Request) {
+		req.SetQuery("attachments", "true")
+	}
+}
+
+// AttEncodingInfo sets the flag for including the encoding information
+// of compressed attachments of a read document.
+func AttEncodingInfo() Parameter {
+	return func(req *Request) {
+		req.SetQuery("att_encoding_info", "true")
+	}
+}
+
+// Bookmark sets the bookmark returned by a previous search index
+// query to retrieve the next page of results.
+func Bookmark(bookmark string) Parameter {
+	return func(req *Request) {
+		req.SetQuery("bookmark", bookmark)
+	}
+}
+
+//--------------------
+// HELPERS
+//--------------------
+
+// basicAuthorization creates the header value for a basic
+// authentication.
+func basicAuthorization(name, password string) string {
+	np := []byte(name + ":" + password)
+	return "Basic " + base64.StdEncoding.EncodeToString(np)
+}
+
 // EOF
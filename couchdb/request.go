@@ -13,16 +13,37 @@ package couchdb // import "tideland.dev/go/db/couchdb"
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"tideland.dev/go/trace/failure"
 	"tideland.dev/go/trace/logger"
 )
 
+//--------------------
+// REQUEST STATISTICS
+//--------------------
+
+// RequestStats contains the statistics of one performed request.
+type RequestStats struct {
+	Method     string
+	Path       string
+	StatusCode int
+	BytesRead  int64
+	Duration   time.Duration
+	Error      error
+}
+
+// RequestObserver is a function receiving the statistics
+// of each request.
+type RequestObserver func(stats RequestStats)
+
 //--------------------
 // REQUEST
 //--------------------
@@ -34,10 +55,13 @@ import (
 type Request struct {
 	db        *Database
 	path      string
+	partition string
 	doc       interface{}
 	docReader io.Reader
 	query     url.Values
 	header    http.Header
+	session   *Session
+	retried   bool
 }
 
 // newRequest creates a new request for the given location, method, and path. If needed
@@ -58,6 +82,13 @@ func (req *Request) SetPath(parts ...string) *Request {
 	return req
 }
 
+// SetPartition sets the partition of the request. The path
+// is extended with the according segment after the database name.
+func (req *Request) SetPartition(partition string) *Request {
+	req.partition = partition
+	return req
+}
+
 // SetDocument sets the document of the request.
 func (req *Request) SetDocument(doc interface{}) *Request {
 	req.doc = doc
@@ -128,46 +159,197 @@ func (req *Request) Delete() *ResultSet {
 	return req.do(http.MethodDelete)
 }
 
-// do performs a request.
+// do performs a request and returns the result set.
 func (req *Request) do(method string) *ResultSet {
+	start := time.Now()
+	httpResp, err := req.perform(method)
+	if err != nil {
+		req.observe(method, start, 0, 0, err)
+		return newResultSet(req.db, nil, err)
+	}
+	rs := newResultSet(req.db, httpResp, nil)
+	req.observe(method, start, rs.statusCode, int64(len(rs.body)), rs.err)
+	return rs
+}
+
+// stream performs a request and decodes the response body directly
+// into the passed value without buffering it.
+func (req *Request) stream(method string, value interface{}) error {
+	start := time.Now()
+	httpResp, err := req.perform(method)
+	if err != nil {
+		req.observe(method, start, 0, 0, err)
+		return err
+	}
+	if httpResp.StatusCode < 200 || httpResp.StatusCode > 299 {
+		rs := newResultSet(req.db, httpResp, nil)
+		err = rs.Error()
+		req.observe(method, start, rs.statusCode, int64(len(rs.body)), err)
+		return err
+	}
+	defer httpResp.Body.Close()
+	counter := &countingReader{reader: httpResp.Body}
+	httpResp.Body = counter
+	body, err := bodyReader(httpResp)
+	if err != nil {
+		err = failure.Annotate(err, "cannot read response body")
+	} else if derr := req.decode(body, value); derr != nil {
+		err = failure.Annotate(derr, "cannot unmarshal database document")
+	}
+	req.observe(method, start, httpResp.StatusCode, counter.count, err)
+	return err
+}
+
+// decode decodes the body into the value. The default codec does
+// it streamed, a configured one needs the read body.
+func (req *Request) decode(body io.Reader, value interface{}) error {
+	if req.db.unmarshal == nil {
+		return json.NewDecoder(body).Decode(value)
+	}
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	return req.db.unmarshal(data, value)
+}
+
+// observe passes the statistics of a request to a configured observer.
+func (req *Request) observe(method string, start time.Time, statusCode int, bytesRead int64, err error) {
+	if req.db.observer == nil {
+		return
+	}
+	req.db.observer(RequestStats{
+		Method:     method,
+		Path:       req.partitionedPath(),
+		StatusCode: statusCode,
+		BytesRead:  bytesRead,
+		Duration:   time.Since(start),
+		Error:      err,
+	})
+}
+
+// perform performs a request and returns the HTTP response. Its
+// body has to be closed by the caller.
+func (req *Request) perform(method string) (*http.Response, error) {
 	// Prepare URL.
 	u := &url.URL{
-		Scheme: "http",
+		Scheme: req.db.scheme,
 		Host:   req.db.host,
-		Path:   req.path,
+		Path:   req.partitionedPath(),
 	}
 	if len(req.query) > 0 {
 		u.RawQuery = req.query.Encode()
 	}
 	// Marshal a potential document.
 	if req.doc != nil {
-		marshalled, err := json.Marshal(req.doc)
+		marshal := json.Marshal
+		if req.db.marshal != nil {
+			marshal = req.db.marshal
+		}
+		marshalled, err := marshal(req.doc)
 		if err != nil {
-			return newResultSet(nil, failure.Annotate(err, "cannot marshal into database document"))
+			return nil, failure.Annotate(err, "cannot marshal into database document")
 		}
 		req.docReader = bytes.NewBuffer(marshalled)
+		if req.db.compression && isBulkPath(req.path) {
+			compressed, err := compress(marshalled)
+			if err != nil {
+				return nil, failure.Annotate(err, "cannot compress database document")
+			}
+			req.docReader = bytes.NewBuffer(compressed)
+			req.header.Set("Content-Encoding", "gzip")
+		}
 	}
 	// Prepare HTTP request.
 	httpReq, err := http.NewRequest(method, u.String(), req.docReader)
 	if err != nil {
-		return newResultSet(nil, failure.Annotate(err, "cannot prepare request"))
+		return nil, failure.Annotate(err, "cannot prepare request")
+	}
+	httpReq.Close = req.db.transport == nil
+	if req.db.authorization != "" && req.header.Get("Authorization") == "" && req.header.Get("Cookie") == "" {
+		req.header.Set("Authorization", req.db.authorization)
 	}
-	httpReq.Close = true
 	if len(req.header) > 0 {
-		httpReq.Header = req.header
+		httpReq.Header = req.header.Clone()
 	}
 	httpReq.Header.Add("Content-Type", "application/json")
 	httpReq.Header.Add("Accept", "application/json")
+	if req.db.compression {
+		httpReq.Header.Set("Accept-Encoding", "gzip")
+	}
 	// Log if wanted.
 	if req.db.logging {
 		logger.Debugf("couchdb request '%s %s'", method, u)
 	}
 	// Perform HTTP request.
-	httpResp, err := http.DefaultClient.Do(httpReq)
+	httpResp, err := req.db.client.Do(httpReq)
 	if err != nil {
-		return newResultSet(nil, failure.Annotate(err, "cannot perform request"))
+		return nil, failure.Annotate(err, "cannot perform request")
+	}
+	// Refresh an expired session and retry once.
+	if httpResp.StatusCode == StatusUnauthorized && req.session != nil && !req.retried {
+		if err := req.session.refresh(req.header.Get("Cookie")); err == nil {
+			httpResp.Body.Close()
+			req.retried = true
+			req.SetHeader("Cookie", req.session.cookie())
+			return req.perform(method)
+		}
+	}
+	return httpResp, nil
+}
+
+// partitionedPath returns the path including a potential
+// partition segment after the database name.
+func (req *Request) partitionedPath() string {
+	if req.partition == "" {
+		return req.path
+	}
+	parts := strings.SplitN(strings.TrimPrefix(req.path, "/"), "/", 2)
+	path := "/" + parts[0] + "/_partition/" + req.partition
+	if len(parts) > 1 {
+		path += "/" + parts[1]
+	}
+	return path
+}
+
+//--------------------
+// HELPERS
+//--------------------
+
+// countingReader counts the bytes read from the wrapped reader.
+type countingReader struct {
+	reader io.ReadCloser
+	count  int64
+}
+
+// Read implements io.Reader.
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.reader.Read(p)
+	cr.count += int64(n)
+	return n, err
+}
+
+// Close implements io.Closer.
+func (cr *countingReader) Close() error {
+	return cr.reader.Close()
+}
+
+// isBulkPath checks if the path addresses a bulk endpoint.
+func isBulkPath(path string) bool {
+	return strings.HasSuffix(path, "/_bulk_docs") || strings.HasSuffix(path, "/_bulk_get")
+}
+
+// compress gzips the passed data.
+func compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
 	}
-	return newResultSet(httpResp, nil)
+	return buf.Bytes(), nil
 }
 
 // EOF
@@ -12,7 +12,9 @@ package couchdb // import "tideland.dev/go/db/couchdb"
 //--------------------
 
 import (
-	"encoding/json"
+	"bytes"
+	"compress/gzip"
+	"io"
 	"io/ioutil"
 	"net/http"
 
@@ -60,14 +62,16 @@ type ResultSet struct {
 	errorText   string
 	errorReason string
 	err         error
+	unmarshal   func(data []byte, v interface{}) error
 }
 
 // newResultSet analyzes the HTTP response and creates a the
 // client ResultSet type out of it.
-func newResultSet(resp *http.Response, err error) *ResultSet {
+func newResultSet(db *Database, resp *http.Response, err error) *ResultSet {
 	rs := &ResultSet{
 		statusCode: 200,
 		err:        err,
+		unmarshal:  db.unmarshal,
 	}
 	switch {
 	case err != nil && failure.Contains(err, "not found"):
@@ -83,7 +87,7 @@ func newResultSet(resp *http.Response, err error) *ResultSet {
 		rs.statusCode = resp.StatusCode
 		// Read body.
 		defer resp.Body.Close()
-		body, err := ioutil.ReadAll(resp.Body)
+		body, err := readBody(resp)
 		if err != nil {
 			rs.err = failure.Annotate(err, "cannot read response body")
 		}
@@ -160,12 +164,16 @@ func (rs *ResultSet) IsDeleted() bool {
 }
 
 // Document returns the received document of a client
-// request and unmorshals it.
+// request and unmorshals it. An empty body of a successful
+// request leaves the value unchanged.
 func (rs *ResultSet) Document(value interface{}) error {
 	if rs.err != nil {
 		return rs.err
 	}
-	err := json.Unmarshal(rs.body, value)
+	if len(rs.body) == 0 && rs.IsOK() {
+		return nil
+	}
+	err := unmarshalWith(rs.unmarshal, rs.body, value)
 	if err != nil {
 		return failure.Annotate(err, "cannot unmarshal database document")
 	}
@@ -193,27 +201,58 @@ func (rs *ResultSet) readDocument() error {
 		if err := rs.Document(&rs.document); err != nil {
 			return err
 		}
-		if id, ok := rs.document["_id"]; ok {
-			rs.id = id.(string)
-		} else if id, ok := rs.document["id"]; ok {
-			rs.id = id.(string)
+		if id, ok := rs.document["_id"].(string); ok {
+			rs.id = id
+		} else if id, ok := rs.document["id"].(string); ok {
+			rs.id = id
 		}
-		if revision, ok := rs.document["_rev"]; ok {
-			rs.revision = revision.(string)
-		} else if revision, ok := rs.document["rev"]; ok {
-			rs.revision = revision.(string)
+		if revision, ok := rs.document["_rev"].(string); ok {
+			rs.revision = revision
+		} else if revision, ok := rs.document["rev"].(string); ok {
+			rs.revision = revision
 		}
-		if deleted, ok := rs.document["_deleted"]; ok {
-			rs.deleted = deleted.(bool)
+		if deleted, ok := rs.document["_deleted"].(bool); ok {
+			rs.deleted = deleted
 		}
-		if errorText, ok := rs.document["error"]; ok {
-			rs.errorText = errorText.(string)
+		if errorText, ok := rs.document["error"].(string); ok {
+			rs.errorText = errorText
 		}
-		if errorReason, ok := rs.document["reason"]; ok {
-			rs.errorReason = errorReason.(string)
+		if errorReason, ok := rs.document["reason"].(string); ok {
+			rs.errorReason = errorReason
 		}
 	}
 	return nil
 }
 
+//--------------------
+// HELPERS
+//--------------------
+
+// readBody reads the body of the response and decompresses
+// it if needed.
+func readBody(resp *http.Response) ([]byte, error) {
+	body, err := bodyReader(resp)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(body)
+}
+
+// bodyReader returns a reader for the body of the response
+// decompressing it if needed.
+func bodyReader(resp *http.Response) (io.Reader, error) {
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		return resp.Body, nil
+	}
+	zr, err := gzip.NewReader(resp.Body)
+	if err == io.EOF {
+		// Empty body, e.g. for HEAD requests.
+		return bytes.NewReader(nil), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return zr, nil
+}
+
 // EOF
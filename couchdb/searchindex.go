@@ -0,0 +1,76 @@
+// Tideland Go Database Clients - CouchDB Client
+//
+// Copyright (C) 2016-2020 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package couchdb // import "tideland.dev/go/db/couchdb"
+
+//--------------------
+// SEARCH RESULT
+//--------------------
+
+// SearchProcessor is a function processing one row of a search index
+// result. The order contains the Lucene score and sort values, the
+// fields those stored by the index function.
+type SearchProcessor func(id string, order, fields, document *Unmarshable) error
+
+// SearchResult provides access to the rows found by a full-text
+// search index. It needs a CouchDB with enabled search or Cloudant.
+type SearchResult struct {
+	db     *Database
+	result *couchdbSearchResult
+}
+
+// newSearchResult queries the search index of a design document with
+// the Lucene query. Parameters like Limit(), Bookmark(), or
+// IncludeDocuments() can be applied.
+func newSearchResult(db *Database, designID, indexID, query string, params ...Parameter) (*SearchResult, error) {
+	req := db.Request().SetPath(db.name, "_design", designID, "_search", indexID)
+	req.SetQuery("q", query)
+	rs := req.ApplyParameters(params...).Get()
+	if !rs.IsOK() {
+		return nil, rs.Error()
+	}
+	result := couchdbSearchResult{}
+	err := rs.Document(&result)
+	if err != nil {
+		return nil, err
+	}
+	return &SearchResult{
+		db:     db,
+		result: &result,
+	}, nil
+}
+
+// TotalRows returns the number of all rows matching the query.
+func (sr *SearchResult) TotalRows() int {
+	return sr.result.TotalRows
+}
+
+// ReturnedRows returns the number of returned rows.
+func (sr *SearchResult) ReturnedRows() int {
+	return len(sr.result.Rows)
+}
+
+// Bookmark returns the opaque bookmark to retrieve the next page
+// of results with the Bookmark() parameter.
+func (sr *SearchResult) Bookmark() string {
+	return sr.result.Bookmark
+}
+
+// Process iterates over the found rows and processes them.
+func (sr *SearchResult) Process(process SearchProcessor) error {
+	for _, row := range sr.result.Rows {
+		order := newUnmarshable(sr.db, row.Order)
+		fields := newUnmarshable(sr.db, row.Fields)
+		doc := newUnmarshable(sr.db, row.Document)
+		if err := process(row.ID, order, fields, doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EOF
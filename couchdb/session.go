@@ -13,6 +13,11 @@ package couchdb // import "tideland.dev/go/db/couchdb"
 
 import (
 	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 //--------------------
@@ -21,9 +26,14 @@ import (
 
 // Session contains the information of a CouchDB session.
 type Session struct {
+	mu          sync.Mutex
 	db          *Database
 	name        string
+	password    string
 	authSession string
+	expiresAt   time.Time
+	autoRefresh bool
+	refreshes   int
 }
 
 // Name returns the users name of this session.
@@ -36,10 +46,30 @@ func (s *Session) Name() string {
 func (s *Session) Cookie() Parameter {
 	return func(req *Request) {
 		req.SetHeader("X-CouchDB-WWW-Authenticate", "Cookie")
-		req.SetHeader("Cookie", s.authSession)
+		req.SetHeader("Cookie", s.cookie())
+		if s.autoRefresh {
+			req.session = s
+		}
 	}
 }
 
+// ExpiresAt returns the time the session cookie expires. It is
+// taken from the cookie attributes, otherwise CouchDBs default
+// timeout of 10 minutes is assumed.
+func (s *Session) ExpiresAt() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.expiresAt
+}
+
+// Refreshes returns how often the session has been
+// authenticated again.
+func (s *Session) Refreshes() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.refreshes
+}
+
 // Stop ends the session.
 func (s *Session) Stop() error {
 	rs := s.db.Request().SetPath(s.db.name).ApplyParameters(s.Cookie()).Delete()
@@ -48,7 +78,75 @@ func (s *Session) Stop() error {
 
 // String returns a string representation of the session.
 func (s *Session) String() string {
-	return fmt.Sprintf("[DB: %q USER: %q SESSION: %q]", s.db.name, s.name, s.authSession)
+	return fmt.Sprintf("[DB: %q USER: %q SESSION: %q]", s.db.name, s.name, s.cookie())
+}
+
+// cookie returns the current session cookie.
+func (s *Session) cookie() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.authSession
+}
+
+// refresh authenticates again if the passed cookie is still
+// the current one. Otherwise a concurrent request already did it.
+func (s *Session) refresh(stale string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.authSession != stale {
+		return nil
+	}
+	_, authSession, expiresAt, err := s.db.authenticate(s.name, s.password)
+	if err != nil {
+		return err
+	}
+	s.authSession = authSession
+	s.expiresAt = expiresAt
+	s.refreshes++
+	return nil
+}
+
+//--------------------
+// HELPERS
+//--------------------
+
+// parseSessionCookie retrieves the AuthSession part of the passed
+// Set-Cookie header and its expiration based on now. Max-Age has
+// priority over Expires like defined in RFC 6265.
+func parseSessionCookie(setCookie string, now time.Time) (string, time.Time) {
+	authSession := ""
+	expiresAt := now.Add(defaultSessionTimeout)
+	hasMaxAge := false
+	for _, part := range strings.Split(setCookie, ";") {
+		part = strings.TrimSpace(part)
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		if kv[0] == "AuthSession" {
+			authSession = part
+			continue
+		}
+		switch strings.ToLower(kv[0]) {
+		case "max-age":
+			seconds, err := strconv.Atoi(kv[1])
+			if err != nil {
+				continue
+			}
+			expiresAt = now.Add(time.Duration(seconds) * time.Second)
+			hasMaxAge = true
+		case "expires":
+			if hasMaxAge {
+				continue
+			}
+			expires, err := http.ParseTime(kv[1])
+			if err != nil {
+				continue
+			}
+			expiresAt = expires
+		}
+	}
+	return authSession, expiresAt
 }
 
 // EOF
@@ -7,6 +7,16 @@
 
 package couchdb // import "tideland.dev/go/db/couchdb"
 
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"reflect"
+
+	"tideland.dev/go/trace/failure"
+)
+
 //--------------------
 // VIEW
 //--------------------
@@ -14,13 +24,21 @@ package couchdb // import "tideland.dev/go/db/couchdb"
 // ViewProcessor is a function processing the content of a view row.
 type ViewProcessor func(id string, key, value, document *Unmarshable) error
 
+// ReducedRow pairs the key of a grouped view row with its
+// reduced value.
+type ReducedRow struct {
+	Key   *Unmarshable
+	Value *Unmarshable
+}
+
 // View provides access to the responded views.
 type View struct {
 	db   *Database
 	view *couchdbView
 }
 
-// newView requests the view document and prepares the access type.
+// newView requests the view document and prepares the access type. The
+// parameter Partition() restricts it to one partition.
 func newView(db *Database, designID, viewID string, params ...Parameter) (*View, error) {
 	rs := db.Request().SetPath(db.name, "_design", designID, "_view", viewID).ApplyParameters(params...).GetOrPost()
 	if !rs.IsOK() {
@@ -55,9 +73,9 @@ func (v *View) Offset() int {
 // Process iterates over the found view documents and processes them.
 func (v *View) Process(process ViewProcessor) error {
 	for _, row := range v.view.Rows {
-		key := NewUnmarshableJSON(row.Key)
-		value := NewUnmarshableJSON(row.Value)
-		doc := NewUnmarshableJSON(row.Document)
+		key := newUnmarshable(v.db, row.Key)
+		value := newUnmarshable(v.db, row.Value)
+		doc := newUnmarshable(v.db, row.Document)
 		if err := process(row.ID, key, value, doc); err != nil {
 			return err
 		}
@@ -65,4 +83,41 @@ func (v *View) Process(process ViewProcessor) error {
 	return nil
 }
 
+// Reduced returns the keys and reduced values of the view rows, e.g.
+// when requested with Group(). The order is the one of the view.
+func (v *View) Reduced() []ReducedRow {
+	rows := make([]ReducedRow, len(v.view.Rows))
+	for i, row := range v.view.Rows {
+		rows[i] = ReducedRow{
+			Key:   newUnmarshable(v.db, row.Key),
+			Value: newUnmarshable(v.db, row.Value),
+		}
+	}
+	return rows
+}
+
+// Documents unmarshals the documents of all view rows into the
+// slice slicePtr points to, e.g. a *[]Worker. The documents are
+// appended, so the view has to be requested with IncludeDocuments().
+func (v *View) Documents(slicePtr interface{}) error {
+	ptr := reflect.ValueOf(slicePtr)
+	if ptr.Kind() != reflect.Ptr || ptr.Elem().Kind() != reflect.Slice {
+		return failure.New("documents destination is no pointer to a slice but %T", slicePtr)
+	}
+	slice := ptr.Elem()
+	elemType := slice.Type().Elem()
+	for index, row := range v.view.Rows {
+		if len(row.Document) == 0 || string(row.Document) == "null" {
+			return failure.New("view row %d (%q) contains no document, IncludeDocuments() not set", index, row.ID)
+		}
+		elem := reflect.New(elemType)
+		if err := unmarshalWith(v.db.unmarshal, row.Document, elem.Interface()); err != nil {
+			return failure.Annotate(err, "cannot unmarshal document of view row %d (%q)", index, row.ID)
+		}
+		slice = reflect.Append(slice, elem.Elem())
+	}
+	ptr.Elem().Set(slice)
+	return nil
+}
+
 // EOF
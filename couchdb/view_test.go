@@ -12,6 +12,10 @@ package couchdb_test // import "tideland.dev/go/db/couchdb_test"
 //--------------------
 
 import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 
@@ -124,4 +128,274 @@ func TestView(t *testing.T) {
 	assert.Nil(err)
 }
 
+// TestViewDocuments tests retrieving the documents of a
+// view as typed slice.
+func TestViewDocuments(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	cdb, cleanup := prepareFilledDatabase(assert, "view-documents")
+	defer cleanup()
+
+	// Create design document.
+	design, err := cdb.Designs().Design("testing")
+	assert.Nil(err)
+	design.SetView("age", "function(doc){ emit(doc.age, doc.name); }", "")
+	resp := design.Write()
+	assert.True(resp.IsOK())
+
+	// Retrieve the documents of the people in their thirties.
+	v, err := cdb.View("testing", "age", couchdb.StartEndKey(30, 39), couchdb.IncludeDocuments())
+	assert.NoError(err)
+	workers := []Worker{}
+	err = v.Documents(&workers)
+	assert.NoError(err)
+	assert.Length(workers, v.ReturnedRows())
+	for _, worker := range workers {
+		assert.True(worker.DocumentID != "")
+		assert.True(worker.Age >= 30 && worker.Age <= 39)
+	}
+
+	// Invalid destination.
+	err = v.Documents(workers)
+	assert.ErrorMatch(err, ".*no pointer to a slice.*")
+
+	// Documents not included.
+	v, err = cdb.View("testing", "age", couchdb.StartEndKey(30, 39))
+	assert.NoError(err)
+	if v.ReturnedRows() > 0 {
+		err = v.Documents(&workers)
+		assert.ErrorMatch(err, ".*contains no document.*")
+	}
+}
+
+// TestGroupedView tests retrieving the reduced values
+// of a grouped view.
+func TestGroupedView(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	cdb, cleanup := prepareFilledDatabase(assert, "grouped-views")
+	defer cleanup()
+
+	// Create design document with counting view.
+	design, err := cdb.Designs().Design("testing")
+	assert.Nil(err)
+	design.SetView("active-age", "function(doc){ if (doc.name) { emit([doc.active, doc.age], 1); } }", "_count")
+	resp := design.Write()
+	assert.True(resp.IsOK())
+
+	// Count by activity.
+	v, err := cdb.View("testing", "active-age", couchdb.Group(1))
+	assert.NoError(err)
+	rows := v.Reduced()
+	assert.True(len(rows) > 0 && len(rows) <= 2)
+	total := 0
+	for _, row := range rows {
+		var key []bool
+		var count int
+		err = row.Key.Unmarshal(&key)
+		assert.Nil(err)
+		assert.Length(key, 1)
+		err = row.Value.Unmarshal(&count)
+		assert.Nil(err)
+		total += count
+	}
+	assert.Equal(total, 1000)
+
+	// Count by activity and age.
+	v, err = cdb.View("testing", "active-age", couchdb.Group(2))
+	assert.NoError(err)
+	rows = v.Reduced()
+	assert.True(len(rows) > 2)
+	total = 0
+	for _, row := range rows {
+		var key []interface{}
+		var count int
+		err = row.Key.Unmarshal(&key)
+		assert.Nil(err)
+		assert.Length(key, 2)
+		err = row.Value.Unmarshal(&count)
+		assert.Nil(err)
+		total += count
+	}
+	assert.Equal(total, 1000)
+}
+
+// TestStaleView tests calling a view with possibly stale results.
+func TestStaleView(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	cdb, cleanup := prepareFilledDatabase(assert, "views-stale")
+	defer cleanup()
+
+	design, err := cdb.Designs().Design("testing")
+	assert.Nil(err)
+	design.SetView("age", "function(doc){ emit(doc.age, doc.name); }", "")
+	resp := design.Write()
+	assert.True(resp.IsOK())
+
+	// First call builds the view.
+	v, err := cdb.View("testing", "age")
+	assert.NoError(err)
+	total := v.TotalRows()
+
+	// Add a document, stale results don't contain it.
+	docA := Worker{
+		DocumentID: "black-jack-4711",
+		Name:       "Jack Black",
+	}
+	resp = cdb.CreateDocument(docA)
+	assert.True(resp.IsOK())
+
+	v, err = cdb.View("testing", "age", couchdb.Stale(couchdb.StaleOK))
+	assert.NoError(err)
+	assert.Equal(v.TotalRows(), total)
+
+	v, err = cdb.View("testing", "age", couchdb.UpdateView(true))
+	assert.NoError(err)
+	assert.Equal(v.TotalRows(), total+1)
+}
+
+// TestList tests calling a list function over a view.
+func TestList(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	cdb, cleanup := prepareFilledDatabase(assert, "lists")
+	defer cleanup()
+
+	// Create design document with view and list.
+	design, err := cdb.Designs().Design("testing")
+	assert.Nil(err)
+	design.SetView("age", "function(doc){ emit(doc.age, doc.name); }", "")
+	design.SetList("names", "function(head, req){ start({headers: {'Content-Type': 'text/plain'}}); var row; while (row = getRow()) { send(row.value + '\\n'); } }")
+	resp := design.Write()
+	assert.True(resp.IsOK())
+	_, ok := design.List("names")
+	assert.True(ok)
+
+	// Call the list with a key range.
+	body, contentType, err := cdb.List("testing", "names", "age", couchdb.StartEndKey(30, 39))
+	assert.NoError(err)
+	assert.Substring("text/plain", contentType)
+	v, err := cdb.View("testing", "age", couchdb.StartEndKey(30, 39))
+	assert.NoError(err)
+	names := strings.Split(strings.TrimSpace(string(body)), "\n")
+	assert.Length(names, v.ReturnedRows())
+}
+
+// TestSearchIndex tests defining and querying a full-text search
+// index. A fake server is used as search needs a special setup.
+func TestSearchIndex(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	var written map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodHead:
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodPut:
+			body, err := ioutil.ReadAll(r.Body)
+			assert.Nil(err)
+			assert.Nil(json.Unmarshal(body, &written))
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"ok": true, "id": "_design/testing", "rev": "1-abc"}`))
+		case r.URL.Path == "/search/_design/testing/_search/by-name":
+			assert.Equal(r.URL.Query().Get("q"), "name:Bob*")
+			assert.Equal(r.URL.Query().Get("bookmark"), "g1AAAA")
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{"total_rows": 3, "bookmark": "g1AAAB", "rows": [
+				{"id": "a", "order": [1.5, 0], "fields": {"name": "Bob"}},
+				{"id": "b", "order": [0.5, 1], "fields": {"name": "Bobby"}}
+			]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": "not_found", "reason": "missing"}`))
+		}
+	}))
+	defer srv.Close()
+	address, port := splitHostPort(assert, srv.URL)
+
+	cdb, err := couchdb.Open(couchdb.Host(address, port), couchdb.Name("search"))
+	assert.Nil(err)
+
+	// Create design document with search index.
+	design, err := cdb.Designs().Design("testing")
+	assert.Nil(err)
+	design.SetSearchIndex("by-name", "function(doc){ index('name', doc.name, {store: true}); }", "standard")
+	indexf, analyzer, ok := design.SearchIndex("by-name")
+	assert.True(ok)
+	assert.Substring("index('name'", indexf)
+	assert.Equal(analyzer, "standard")
+	_, _, ok = design.SearchIndex("by-age")
+	assert.False(ok)
+	resp := design.Write()
+	assert.True(resp.IsOK())
+	indexes, ok := written["indexes"].(map[string]interface{})
+	assert.True(ok)
+	assert.Length(indexes, 1)
+
+	// Query the search index.
+	sr, err := cdb.SearchIndex("testing", "by-name", "name:Bob*", couchdb.Bookmark("g1AAAA"))
+	assert.NoError(err)
+	assert.Equal(sr.TotalRows(), 3)
+	assert.Equal(sr.ReturnedRows(), 2)
+	assert.Equal(sr.Bookmark(), "g1AAAB")
+	ids := []string{}
+	scores := []float64{}
+	err = sr.Process(func(id string, order, fields, document *couchdb.Unmarshable) error {
+		var o []float64
+		if err := order.Unmarshal(&o); err != nil {
+			return err
+		}
+		var f struct {
+			Name string `json:"name"`
+		}
+		if err := fields.Unmarshal(&f); err != nil {
+			return err
+		}
+		assert.Substring("Bob", f.Name)
+		ids = append(ids, id)
+		scores = append(scores, o[0])
+		return nil
+	})
+	assert.NoError(err)
+	assert.Equal(ids, []string{"a", "b"})
+	assert.Equal(scores, []float64{1.5, 0.5})
+
+	// Unknown index.
+	_, err = cdb.SearchIndex("testing", "by-age", "age:[30 TO 40]")
+	assert.ErrorMatch(err, ".*not_found.*")
+}
+
+// TestUnmarshableIsNil tests checking unmarshables for
+// missing messages.
+func TestUnmarshableIsNil(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+
+	assert.True(couchdb.NewUnmarshableJSON(nil).IsNil())
+	assert.True(couchdb.NewUnmarshableRaw([]byte{}).IsNil())
+	assert.False(couchdb.NewUnmarshableRaw([]byte("{}")).IsNil())
+	assert.False(couchdb.NewUnmarshableRaw([]byte("null")).IsNil())
+
+	var u *couchdb.Unmarshable
+	assert.True(u.IsNil())
+}
+
+// TestUnmarshableNumbers tests keeping the precision of
+// large numbers.
+func TestUnmarshableNumbers(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	u := couchdb.NewUnmarshableRaw([]byte(`{"id": 9007199254740993}`))
+
+	// Standard unmarshalling loses precision.
+	var lossy map[string]interface{}
+	err := u.Unmarshal(&lossy)
+	assert.Nil(err)
+	assert.Equal(lossy["id"], float64(9007199254740992))
+
+	// Unmarshalling with numbers keeps it.
+	var exact map[string]interface{}
+	err = u.UnmarshalWithNumbers(&exact)
+	assert.Nil(err)
+	n, ok := exact["id"].(json.Number)
+	assert.True(ok)
+	i, err := n.Int64()
+	assert.Nil(err)
+	assert.Equal(i, int64(9007199254740993))
+}
+
 // EOF
@@ -0,0 +1,323 @@
+// Tideland Go Database Clients - Redis Client
+//
+// Copyright (C) 2017-2020 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redis // import "tideland.dev/go/db/redis"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tideland.dev/go/trace/failure"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	// clusterSlots is the number of hash slots of a Redis Cluster.
+	clusterSlots = 16384
+
+	// maxRedirections limits the following of MOVED and ASK.
+	maxRedirections = 5
+)
+
+//--------------------
+// CLUSTER
+//--------------------
+
+// Cluster provides access to a Redis Cluster. Each command is routed
+// to the node owning the hash slot of the commands key, which is
+// expected as first argument. Commands without key are sent to the
+// node owning slot 0. Redirections by the nodes are followed.
+type Cluster struct {
+	mu      sync.RWMutex
+	options []Option
+	timeout time.Duration
+	nodes   map[string]*Database
+	slots   []string
+}
+
+// OpenCluster opens a client for a Redis Cluster. The passed options
+// are used for all nodes, the address of the TCP connection is used
+// for the initial retrieval of the slot map.
+func OpenCluster(options ...Option) (*Cluster, error) {
+	seed, err := Open(options...)
+	if err != nil {
+		return nil, err
+	}
+	if seed.network != "tcp" {
+		seed.Close()
+		return nil, failure.New("cluster needs TCP connection")
+	}
+	c := &Cluster{
+		options: options,
+		timeout: seed.timeout,
+		nodes: map[string]*Database{
+			seed.address: seed,
+		},
+		slots: make([]string, clusterSlots),
+	}
+	if err := c.refreshSlots(); err != nil {
+		seed.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Nodes returns the addresses of the currently known nodes.
+func (c *Cluster) Nodes() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	addresses := []string{}
+	for address := range c.nodes {
+		addresses = append(addresses, address)
+	}
+	return addresses
+}
+
+// Do executes one Redis command on the node owning the key
+// and returns the result as result set.
+func (c *Cluster) Do(cmd string, args ...interface{}) (*ResultSet, error) {
+	key := ""
+	if len(args) > 0 {
+		key = string(valueToBytes(args[0]))
+	}
+	slot := keySlot(key)
+	c.mu.RLock()
+	address := c.slots[slot]
+	c.mu.RUnlock()
+	asking := false
+	for i := 0; i < maxRedirections; i++ {
+		result, err := c.doOnNode(address, asking, cmd, args...)
+		if err != nil {
+			return nil, err
+		}
+		kind, target, ok := redirection(result)
+		if !ok {
+			return result, nil
+		}
+		switch kind {
+		case "MOVED":
+			// Slot is owned by another node now.
+			c.mu.Lock()
+			c.slots[slot] = target
+			c.mu.Unlock()
+			asking = false
+		case "ASK":
+			// Slot is migrating, only this command goes to target.
+			asking = true
+		}
+		address = target
+	}
+	return nil, failure.New("too many redirections for %s", cmd)
+}
+
+// DoValue executes one Redis command on the node owning
+// the key and returns a single value.
+func (c *Cluster) DoValue(cmd string, args ...interface{}) (Value, error) {
+	result, err := c.Do(cmd, args...)
+	if err != nil {
+		return nil, err
+	}
+	return result.ValueAt(0)
+}
+
+// Close closes the clients of all nodes.
+func (c *Cluster) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var err error
+	for address, db := range c.nodes {
+		cerr := db.Close()
+		if err == nil {
+			err = cerr
+		}
+		delete(c.nodes, address)
+	}
+	return err
+}
+
+// doOnNode executes the command on the node with the given address.
+func (c *Cluster) doOnNode(address string, asking bool, cmd string, args ...interface{}) (*ResultSet, error) {
+	db, err := c.node(address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := db.Connection()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Return()
+	if asking {
+		if _, err := conn.Do("asking"); err != nil {
+			return nil, err
+		}
+	}
+	return conn.Do(cmd, args...)
+}
+
+// node returns the database client for the node with the given
+// address. It is opened if not yet known.
+func (c *Cluster) node(address string) (*Database, error) {
+	c.mu.RLock()
+	db, ok := c.nodes[address]
+	c.mu.RUnlock()
+	if ok {
+		return db, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if db, ok := c.nodes[address]; ok {
+		return db, nil
+	}
+	options := append([]Option{}, c.options...)
+	options = append(options, TCPConnection(address, c.timeout))
+	db, err := Open(options...)
+	if err != nil {
+		return nil, err
+	}
+	c.nodes[address] = db
+	return db, nil
+}
+
+// refreshSlots retrieves the slot map from one of the known nodes.
+func (c *Cluster) refreshSlots() error {
+	var err error
+	for _, address := range c.Nodes() {
+		var result *ResultSet
+		result, err = c.doOnNode(address, false, "cluster", "slots")
+		if err != nil {
+			continue
+		}
+		var slots []string
+		slots, err = parseSlots(result, address)
+		if err != nil {
+			continue
+		}
+		c.mu.Lock()
+		c.slots = slots
+		c.mu.Unlock()
+		return nil
+	}
+	return failure.Annotate(err, "cannot retrieve cluster slots")
+}
+
+//--------------------
+// HELPERS
+//--------------------
+
+// parseSlots maps the result of CLUSTER SLOTS to the addresses
+// of the owning master nodes. An empty IP means the queried node.
+func parseSlots(result *ResultSet, queried string) ([]string, error) {
+	queriedHost, _, err := net.SplitHostPort(queried)
+	if err != nil {
+		return nil, err
+	}
+	slots := make([]string, clusterSlots)
+	for i := 0; i < result.Len(); i++ {
+		slotRange, err := result.ResultSetAt(i)
+		if err != nil {
+			return nil, err
+		}
+		start, err := slotRange.IntAt(0)
+		if err != nil {
+			return nil, err
+		}
+		end, err := slotRange.IntAt(1)
+		if err != nil {
+			return nil, err
+		}
+		master, err := slotRange.ResultSetAt(2)
+		if err != nil {
+			return nil, err
+		}
+		host, err := master.StringAt(0)
+		if err != nil {
+			return nil, err
+		}
+		if host == "" {
+			host = queriedHost
+		}
+		port, err := master.IntAt(1)
+		if err != nil {
+			return nil, err
+		}
+		if start < 0 || end >= clusterSlots || start > end {
+			return nil, failure.New("invalid cluster slot range %d - %d", start, end)
+		}
+		address := net.JoinHostPort(host, strconv.Itoa(port))
+		for slot := start; slot <= end; slot++ {
+			slots[slot] = address
+		}
+	}
+	for slot, address := range slots {
+		if address == "" {
+			return nil, failure.New("cluster slot %d not covered", slot)
+		}
+	}
+	return slots, nil
+}
+
+// redirection checks if the result is a MOVED or ASK error and
+// returns its kind and target address.
+func redirection(result *ResultSet) (string, string, bool) {
+	if result.Len() != 1 {
+		return "", "", false
+	}
+	value, err := result.ValueAt(0)
+	if err != nil {
+		return "", "", false
+	}
+	fields := strings.Fields(value.String())
+	if len(fields) != 3 {
+		return "", "", false
+	}
+	switch fields[0] {
+	case "-MOVED":
+		return "MOVED", fields[2], true
+	case "-ASK":
+		return "ASK", fields[2], true
+	}
+	return "", "", false
+}
+
+// keySlot returns the hash slot of a key. If the key contains a
+// hash tag in curly braces only this is used.
+func keySlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key)) % clusterSlots
+}
+
+// crc16 calculates the CRC16 (XMODEM) checksum used by Redis Cluster.
+func crc16(key string) uint16 {
+	var crc uint16
+	for i := 0; i < len(key); i++ {
+		crc ^= uint16(key[i]) << 8
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// EOF
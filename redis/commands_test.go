@@ -12,6 +12,10 @@ package redis_test
 //--------------------
 
 import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -81,6 +85,134 @@ func TestSimpleKeyOperations(t *testing.T) {
 	assert.Equal(ssOut, ssIn)
 }
 
+func TestSelect(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	db, err := redis.Open(redis.TCPConnection("", testTimeout), redis.Index(testDatabaseIndex, ""), redis.PoolSize(1))
+	assert.Nil(err)
+	defer db.Close()
+	conn, err := db.Connection()
+	assert.Nil(err)
+	_, err = conn.Do("flushdb")
+	assert.Nil(err)
+
+	// Key only exists in the other database.
+	err = conn.Select(testDatabaseIndex + 1)
+	assert.Nil(err)
+	_, err = conn.Do("flushdb")
+	assert.Nil(err)
+	ok, err := conn.DoOK("set", "select:key", "other")
+	assert.Nil(err)
+	assert.True(ok)
+	value, err := conn.DoString("get", "select:key")
+	assert.Nil(err)
+	assert.Equal(value, "other")
+	err = conn.Select(testDatabaseIndex)
+	assert.Nil(err)
+	exists, err := conn.DoBool("exists", "select:key")
+	assert.Nil(err)
+	assert.False(exists)
+
+	// Next retrieval selects the configured database again.
+	err = conn.Select(testDatabaseIndex + 1)
+	assert.Nil(err)
+	assert.Nil(conn.Return())
+	conn, err = db.Connection()
+	assert.Nil(err)
+	defer conn.Return()
+	exists, err = conn.DoBool("exists", "select:key")
+	assert.Nil(err)
+	assert.False(exists)
+
+	err = conn.Select(-1)
+	assert.ErrorMatch(err, ".*invalid database index -1.*")
+}
+
+func TestGetDelGetEx(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	conn, restore := connectDatabase(t, assert)
+	defer restore()
+
+	ok, err := conn.DoOK("set", "token", "one-time")
+	assert.Nil(err)
+	assert.True(ok)
+	value, err := conn.GetDel("token")
+	assert.Nil(err)
+	assert.Equal(value.String(), "one-time")
+	exists, err := conn.DoBool("exists", "token")
+	assert.Nil(err)
+	assert.False(exists)
+	value, err = conn.GetDel("token")
+	assert.Nil(err)
+	assert.True(value.IsNil())
+
+	ok, err = conn.DoOK("set", "cache", "sliding")
+	assert.Nil(err)
+	assert.True(ok)
+	value, err = conn.GetEx("cache", 100*time.Second)
+	assert.Nil(err)
+	assert.Equal(value.String(), "sliding")
+	ttl, err := conn.DoInt("ttl", "cache")
+	assert.Nil(err)
+	assert.True(ttl > 90 && ttl <= 100)
+	value, err = conn.GetEx("cache", 1500*time.Millisecond)
+	assert.Nil(err)
+	assert.Equal(value.String(), "sliding")
+	pttl, err := conn.DoInt("pttl", "cache")
+	assert.Nil(err)
+	assert.True(pttl > 1000 && pttl <= 1500)
+	_, err = conn.GetEx("cache", 0)
+	assert.Nil(err)
+	ttl, err = conn.DoInt("ttl", "cache")
+	assert.Nil(err)
+	assert.Equal(ttl, -1)
+	_, err = conn.GetEx("cache", -time.Second)
+	assert.ErrorMatch(err, ".*invalid expiration.*")
+}
+
+func TestObject(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	conn, restore := connectDatabase(t, assert)
+	defer restore()
+
+	// Strings.
+	ok, err := conn.DoOK("set", "object:int", 12345)
+	assert.Nil(err)
+	assert.True(ok)
+	encoding, err := conn.ObjectEncoding("object:int")
+	assert.Nil(err)
+	assert.Equal(encoding, "int")
+	ok, err = conn.DoOK("set", "object:raw", strings.Repeat("x", 100))
+	assert.Nil(err)
+	assert.True(ok)
+	encoding, err = conn.ObjectEncoding("object:raw")
+	assert.Nil(err)
+	assert.Equal(encoding, "raw")
+
+	// Small and large hashes.
+	_, err = conn.Do("hset", "object:hash", "field", "value")
+	assert.Nil(err)
+	encoding, err = conn.ObjectEncoding("object:hash")
+	assert.Nil(err)
+	assert.Match(encoding, "ziplist|listpack")
+	for i := 0; i < 1000; i++ {
+		_, err = conn.Do("hset", "object:hash", fmt.Sprintf("field:%d", i), i)
+		assert.Nil(err)
+	}
+	encoding, err = conn.ObjectEncoding("object:hash")
+	assert.Nil(err)
+	assert.Equal(encoding, "hashtable")
+
+	idle, err := conn.ObjectIdleTime("object:raw")
+	assert.Nil(err)
+	assert.True(idle >= 0 && idle < time.Minute)
+	refs, err := conn.ObjectRefCount("object:raw")
+	assert.Nil(err)
+	assert.Equal(refs, 1)
+
+	_, err = conn.ObjectEncoding("object:missing")
+	assert.ErrorMatch(err, ".*key \"object:missing\" not found.*")
+}
+
 func TestScan(t *testing.T) {
 	assert := asserts.NewTesting(t, asserts.FailStop)
 	conn, restore := connectDatabase(t, assert)
@@ -118,6 +250,50 @@ func TestScan(t *testing.T) {
 	assert.Equal(valueCount, 26*26)
 }
 
+func TestStringSliceArguments(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	conn, restore := connectDatabase(t, assert)
+	defer restore()
+
+	length, err := conn.DoInt("rpush", "list:strings", []string{"a", "b", "c"})
+	assert.Nil(err)
+	assert.Equal(length, 3)
+	values, err := conn.DoStrings("lrange", "list:strings", 0, -1)
+	assert.Nil(err)
+	assert.Equal(values, []string{"a", "b", "c"})
+
+	// Mixed with other arguments.
+	length, err = conn.DoInt("rpush", "list:strings", "d", []string{"e\r\nf", ""}, "g")
+	assert.Nil(err)
+	assert.Equal(length, 7)
+	values, err = conn.DoStrings("lrange", "list:strings", 3, -1)
+	assert.Nil(err)
+	assert.Equal(values, []string{"d", "e\r\nf", "", "g"})
+}
+
+func TestByteSlices(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	conn, restore := connectDatabase(t, assert)
+	defer restore()
+
+	blobs := [][]byte{
+		{0x00, 0xff, 0xfe, 'a', 0x00},
+		{'\r', '\n', 0xc3, 0x28},
+		{},
+	}
+	for _, blob := range blobs {
+		_, err := conn.Do("rpush", "list:blobs", blob)
+		assert.Nil(err)
+	}
+	values, err := conn.DoByteSlices("lrange", "list:blobs", 0, -1)
+	assert.Nil(err)
+	assert.Equal(values, blobs)
+
+	// Nested arrays are no byte slices.
+	_, err = conn.DoByteSlices("scan", 0)
+	assert.ErrorMatch(err, ".*item at index 1 is no value.*")
+}
+
 func TestHash(t *testing.T) {
 	assert := asserts.NewTesting(t, asserts.FailStop)
 	conn, restore := connectDatabase(t, assert)
@@ -128,7 +304,7 @@ func TestHash(t *testing.T) {
 		"e2": "bar",
 		"e3": "yadda",
 	}
-	ok, err := conn.DoOK("hmset", "hash", "a", "foo", "b", 2, "c", 3.3, "d", true, "e", e)
+	ok, err := conn.DoOK("hmset", "hash", "a", "foo", "b", 2, "c", 3.3, "d", true, redis.NewHash().Set("e", e))
 	assert.Nil(err)
 	assert.True(ok)
 
@@ -155,6 +331,147 @@ func TestHash(t *testing.T) {
 	assert.Equal(valueE, e)
 }
 
+func TestHashFieldExpiration(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	conn, restore := connectDatabase(t, assert)
+	defer restore()
+
+	_, err := conn.Do("hset", "cache", "a", 1, "b", 2, "c", 3)
+	assert.Nil(err)
+	statuses, err := conn.HExpire("cache", 100*time.Second, "a", "b", "missing")
+	assert.Nil(err)
+	assert.Equal(statuses, []int{1, 1, -2})
+	statuses, err = conn.HExpire("cache", 1500*time.Millisecond, "b")
+	assert.Nil(err)
+	assert.Equal(statuses, []int{1})
+
+	ttls, err := conn.HTTL("cache", "a", "b", "c", "missing")
+	assert.Nil(err)
+	assert.Length(ttls, 4)
+	assert.True(ttls[0] > 90 && ttls[0] <= 100)
+	assert.True(ttls[1] >= 0 && ttls[1] <= 2)
+	assert.Equal(ttls[2], -1)
+	assert.Equal(ttls[3], -2)
+
+	// TTL of 0 deletes the field.
+	statuses, err = conn.HExpire("cache", 0, "c")
+	assert.Nil(err)
+	assert.Equal(statuses, []int{2})
+	exists, err := conn.DoBool("hexists", "cache", "c")
+	assert.Nil(err)
+	assert.False(exists)
+
+	_, err = conn.HTTL("cache")
+	assert.ErrorMatch(err, ".*no fields for httl.*")
+	_, err = conn.HExpire("cache", -time.Second, "a")
+	assert.ErrorMatch(err, ".*invalid time to live.*")
+}
+
+func TestConfig(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	conn, restore := connectDatabase(t, assert)
+	defer restore()
+
+	config, err := conn.ConfigGet("maxmemory-policy")
+	assert.Nil(err)
+	assert.Length(config, 1)
+	policy, ok := config["maxmemory-policy"]
+	assert.True(ok)
+	defer conn.ConfigSet("maxmemory-policy", policy)
+
+	err = conn.ConfigSet("maxmemory-policy", "allkeys-lru")
+	assert.Nil(err)
+	config, err = conn.ConfigGet("maxmemory-*")
+	assert.Nil(err)
+	assert.True(len(config) > 1)
+	assert.Equal(config["maxmemory-policy"], "allkeys-lru")
+
+	config, err = conn.ConfigGet("not-existing-*")
+	assert.Nil(err)
+	assert.Length(config, 0)
+
+	err = conn.ConfigSet("maxmemory-policy", "invalid-policy")
+	assert.ErrorMatch(err, ".*cannot set config \"maxmemory-policy\".*")
+}
+
+func TestDebugSleep(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	conn, restore := connectDatabase(t, assert)
+	defer restore()
+
+	start := time.Now()
+	err := conn.DebugSleep(200 * time.Millisecond)
+	if err != nil && strings.Contains(err.Error(), "not allowed") {
+		t.Skip("DEBUG command is disabled")
+	}
+	assert.Nil(err)
+	assert.True(time.Since(start) >= 200*time.Millisecond)
+
+	err = conn.DebugSleep(-time.Second)
+	assert.ErrorMatch(err, ".*invalid sleep duration.*")
+
+	// Sleeping longer than the read timeout.
+	db, err := redis.Open(redis.TCPConnection("", testTimeout), redis.ReadTimeout(100*time.Millisecond))
+	assert.Nil(err)
+	defer db.Close()
+	sleeper, err := db.Connection()
+	assert.Nil(err)
+	defer sleeper.Return()
+	start = time.Now()
+	err = sleeper.DebugSleep(time.Second)
+	assert.NotNil(err)
+	assert.True(time.Since(start) < time.Second)
+}
+
+func TestScanStruct(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	conn, restore := connectDatabase(t, assert)
+	defer restore()
+
+	type User struct {
+		Name     string    `redis:"name"`
+		Age      int       `redis:"age"`
+		Visits   uint64    `redis:"visits"`
+		Active   bool      `redis:"active"`
+		Score    float64   `redis:"score"`
+		Created  time.Time `redis:"created"`
+		Avatar   []byte
+		Password string `redis:"-"`
+	}
+	created := time.Now().Truncate(time.Second)
+	ok, err := conn.DoOK("hmset", "user:1",
+		"name", "foo",
+		"age", 42,
+		"visits", 12345,
+		"active", true,
+		"score", 98.5,
+		"created", created.Unix(),
+		"Avatar", []byte{1, 2, 3},
+		"-", "secret",
+		"unknown", "ignored",
+	)
+	assert.Nil(err)
+	assert.True(ok)
+
+	user := User{}
+	err = conn.DoScanStruct(&user, "hgetall", "user:1")
+	assert.Nil(err)
+	assert.Equal(user.Name, "foo")
+	assert.Equal(user.Age, 42)
+	assert.Equal(user.Visits, uint64(12345))
+	assert.True(user.Active)
+	assert.Equal(user.Score, 98.5)
+	assert.True(user.Created.Equal(created))
+	assert.Equal(user.Avatar, []byte{1, 2, 3})
+	assert.Equal(user.Password, "")
+
+	err = conn.DoScanStruct(user, "hgetall", "user:1")
+	assert.ErrorMatch(err, ".*no pointer to a struct.*")
+	conn.Do("hset", "user:1", "age", "old")
+	err = conn.DoScanStruct(&user, "hgetall", "user:1")
+	assert.ErrorMatch(err, ".*cannot set field \"Age\".*")
+}
+
 func TestHScan(t *testing.T) {
 	assert := asserts.NewTesting(t, asserts.FailStop)
 	conn, restore := connectDatabase(t, assert)
@@ -208,6 +525,94 @@ func TestList(t *testing.T) {
 	assert.Equal(popped, 5)
 }
 
+func TestBlockingPop(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	conn, restore := connectDatabase(t, assert)
+	defer restore()
+
+	_, err := conn.DoInt("rpush", "list:b", "a", "b", "c")
+	assert.Nil(err)
+	key, value, err := conn.BLPop(time.Second, "list:a", "list:b")
+	assert.Nil(err)
+	assert.Equal(key, "list:b")
+	assert.Equal(value.String(), "a")
+	key, value, err = conn.BRPop(time.Second, "list:a", "list:b")
+	assert.Nil(err)
+	assert.Equal(key, "list:b")
+	assert.Equal(value.String(), "c")
+
+	// Timeout is no empty value.
+	_, _, err = conn.BLPop(time.Second, "list:a")
+	assert.True(redis.IsTimeout(err))
+	_, _, err = conn.BRPop(time.Second)
+	assert.ErrorMatch(err, ".*no keys to pop from.*")
+
+	// Push while blocking.
+	db, err := redis.Open(redis.TCPConnection("", testTimeout), redis.Index(testDatabaseIndex, ""))
+	assert.Nil(err)
+	defer db.Close()
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		pushConn, err := db.Connection()
+		if err != nil {
+			return
+		}
+		defer pushConn.Return()
+		pushConn.Do("lpush", "list:a", "pushed")
+	}()
+	key, value, err = conn.BLPop(5*time.Second, "list:a")
+	assert.Nil(err)
+	assert.Equal(key, "list:a")
+	assert.Equal(value.String(), "pushed")
+}
+
+func TestDoStream(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	conn, restore := connectDatabase(t, assert)
+	defer restore()
+
+	const total = 100000
+	batch := make([]string, 10000)
+	for i := 0; i < total; i += len(batch) {
+		for j := range batch {
+			batch[j] = strconv.Itoa(i + j)
+		}
+		_, err := conn.DoInt("rpush", "stream:list", batch)
+		assert.Nil(err)
+	}
+
+	// Only count and sum, don't retain.
+	count := 0
+	sum := 0
+	err := conn.DoStream(func(value redis.Value) error {
+		i, err := value.Int()
+		if err != nil {
+			return err
+		}
+		count++
+		sum += i
+		return nil
+	}, "lrange", "stream:list", 0, -1)
+	assert.Nil(err)
+	assert.Equal(count, total)
+	assert.Equal(sum, total*(total-1)/2)
+
+	// Stop early, connection is still usable.
+	count = 0
+	err = conn.DoStream(func(value redis.Value) error {
+		count++
+		if count == 10 {
+			return failure.New("enough")
+		}
+		return nil
+	}, "lrange", "stream:list", 0, -1)
+	assert.ErrorMatch(err, ".*enough.*")
+	assert.Equal(count, 10)
+	length, err := conn.DoInt("llen", "stream:list")
+	assert.Nil(err)
+	assert.Equal(length, total)
+}
+
 func TestSet(t *testing.T) {
 	assert := asserts.NewTesting(t, asserts.FailStop)
 	conn, restore := connectDatabase(t, assert)
@@ -229,6 +634,47 @@ func TestSet(t *testing.T) {
 	assert.True(rand >= 1 && rand <= 5)
 }
 
+func TestSetCardinalities(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	conn, restore := connectDatabase(t, assert)
+	defer restore()
+
+	_, err := conn.DoInt("sadd", "audience:a", 1, 2, 3, 4, 5, 6)
+	assert.Nil(err)
+	_, err = conn.DoInt("sadd", "audience:b", 4, 5, 6, 7, 8)
+	assert.Nil(err)
+	card, err := conn.SCard("audience:a")
+	assert.Nil(err)
+	assert.Equal(card, 6)
+
+	card, err = conn.SInterCard(0, "audience:a", "audience:b")
+	assert.Nil(err)
+	assert.Equal(card, 3)
+	card, err = conn.SInterCard(2, "audience:a", "audience:b")
+	assert.Nil(err)
+	assert.Equal(card, 2)
+	card, err = conn.SInterCard(0, "audience:a", "audience:missing")
+	assert.Nil(err)
+	assert.Equal(card, 0)
+	_, err = conn.SInterCard(0)
+	assert.ErrorMatch(err, ".*no keys to intersect.*")
+	_, err = conn.SInterCard(-1, "audience:a")
+	assert.ErrorMatch(err, ".*invalid limit -1.*")
+
+	card, err = conn.SDiffStore("audience:diff", "audience:a", "audience:b")
+	assert.Nil(err)
+	assert.Equal(card, 3)
+	card, err = conn.SInterStore("audience:inter", "audience:a", "audience:b")
+	assert.Nil(err)
+	assert.Equal(card, 3)
+	card, err = conn.SUnionStore("audience:union", "audience:a", "audience:b")
+	assert.Nil(err)
+	assert.Equal(card, 8)
+	card, err = conn.SCard("audience:union")
+	assert.Nil(err)
+	assert.Equal(card, 8)
+}
+
 func TestSScan(t *testing.T) {
 	assert := asserts.NewTesting(t, asserts.FailStop)
 	conn, restore := connectDatabase(t, assert)
@@ -287,6 +733,162 @@ func TestSortedSet(t *testing.T) {
 	assert.Equal(scoredValues[2].Score, 5.0)
 }
 
+func TestFloats(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	conn, restore := connectDatabase(t, assert)
+	defer restore()
+
+	conn.Do("zadd", "floats", 1.5, "a", "inf", "b", "-inf", "c")
+	score, err := conn.DoFloat("zscore", "floats", "a")
+	assert.Nil(err)
+	assert.Equal(score, 1.5)
+	score, err = conn.DoFloat("zscore", "floats", "b")
+	assert.Nil(err)
+	assert.True(math.IsInf(score, 1))
+	score, err = conn.DoFloat("zscore", "floats", "c")
+	assert.Nil(err)
+	assert.True(math.IsInf(score, -1))
+
+	counter, err := conn.DoFloat("incrbyfloat", "floats:counter", 0.25)
+	assert.Nil(err)
+	assert.Equal(counter, 0.25)
+	counter, err = conn.DoFloat("incrbyfloat", "floats:counter", 1.5)
+	assert.Nil(err)
+	assert.Equal(counter, 1.75)
+
+	nan, err := redis.NewValue("nan").Float64()
+	assert.Nil(err)
+	assert.True(math.IsNaN(nan))
+	_, err = conn.DoFloat("zscore", "floats", "d")
+	assert.NotNil(err)
+
+	scores, err := conn.DoFloats("zmscore", "floats", "a", "d", "b", "c")
+	assert.Nil(err)
+	assert.Length(scores, 4)
+	assert.Equal(scores[0], 1.5)
+	assert.True(math.IsNaN(scores[1]))
+	assert.True(math.IsInf(scores[2], 1))
+	assert.True(math.IsInf(scores[3], -1))
+	_, err = conn.DoFloats("scan", 0)
+	assert.ErrorMatch(err, ".*item at index 1 is no value.*")
+}
+
+func TestValueConversions(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	conn, restore := connectDatabase(t, assert)
+	defer restore()
+
+	value, err := conn.DoValue("set", "value:a", 9223372036854775807)
+	assert.Nil(err)
+	ok, err := value.Bool()
+	assert.Nil(err)
+	assert.True(ok)
+	value, err = conn.DoValue("get", "value:a")
+	assert.Nil(err)
+	i, err := value.Int64()
+	assert.Nil(err)
+	assert.Equal(i, int64(9223372036854775807))
+	_, err = value.Bool()
+	assert.ErrorMatch(err, ".*invalid type conversion of .* to \"bool\".*")
+
+	value, err = conn.DoValue("exists", "value:a")
+	assert.Nil(err)
+	ok, err = value.Bool()
+	assert.Nil(err)
+	assert.True(ok)
+	value, err = conn.DoValue("exists", "value:b")
+	assert.Nil(err)
+	ok, err = value.Bool()
+	assert.Nil(err)
+	assert.False(ok)
+	i, err = value.Int64()
+	assert.Nil(err)
+	assert.Equal(i, int64(0))
+
+	value, err = conn.DoValue("incrby", "value:c", -42)
+	assert.Nil(err)
+	i, err = value.Int64()
+	assert.Nil(err)
+	assert.Equal(i, int64(-42))
+	_, err = conn.DoValue("set", "value:d", "foo")
+	assert.Nil(err)
+	value, err = conn.DoValue("get", "value:d")
+	assert.Nil(err)
+	_, err = value.Int64()
+	assert.ErrorMatch(err, ".*invalid type conversion of .* to \"int64\".*")
+}
+
+func TestTimeValues(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	conn, restore := connectDatabase(t, assert)
+	defer restore()
+
+	ok, err := conn.DoOK("set", "time:a", 1577836800)
+	assert.Nil(err)
+	assert.True(ok)
+	value, err := conn.DoValue("get", "time:a")
+	assert.Nil(err)
+	tm, err := value.Time()
+	assert.Nil(err)
+	assert.True(tm.Equal(time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)))
+
+	result, err := conn.Do("time")
+	assert.Nil(err)
+	value, err = result.ValueAt(0)
+	assert.Nil(err)
+	tm, err = value.Time()
+	assert.Nil(err)
+	assert.True(time.Since(tm) < time.Minute)
+
+	ok, err = conn.DoBool("expire", "time:a", 100)
+	assert.Nil(err)
+	assert.True(ok)
+	value, err = conn.DoValue("ttl", "time:a")
+	assert.Nil(err)
+	d, err := value.Duration()
+	assert.Nil(err)
+	assert.True(d > 90*time.Second && d <= 100*time.Second)
+
+	// Durations and times as arguments.
+	ok, err = conn.DoBool("expire", "time:a", 10*time.Second)
+	assert.Nil(err)
+	assert.True(ok)
+	ttl, err := conn.DoInt("ttl", "time:a")
+	assert.Nil(err)
+	assert.True(ttl > 8 && ttl <= 10)
+	ok, err = conn.DoBool("pexpire", "time:a", redis.PDuration(20*time.Second))
+	assert.Nil(err)
+	assert.True(ok)
+	pttl, err := conn.DoInt("pttl", "time:a")
+	assert.Nil(err)
+	assert.True(pttl > 18000 && pttl <= 20000)
+	value, err = conn.DoValue("pttl", "time:a")
+	assert.Nil(err)
+	d, err = value.PDuration()
+	assert.Nil(err)
+	assert.True(d > 18*time.Second && d <= 20*time.Second)
+	ok, err = conn.DoBool("expireat", "time:a", time.Now().Add(time.Hour))
+	assert.Nil(err)
+	assert.True(ok)
+	ttl, err = conn.DoInt("ttl", "time:a")
+	assert.Nil(err)
+	assert.True(ttl > 3500 && ttl <= 3600)
+
+	value, err = conn.DoValue("ttl", "time:b")
+	assert.Nil(err)
+	d, err = value.Duration()
+	assert.Nil(err)
+	assert.Equal(d, -2*time.Second)
+
+	value = redis.NewValue("foo")
+	_, err = value.Time()
+	assert.ErrorMatch(err, ".*invalid type conversion of .* to \"time\".*")
+	_, err = value.Duration()
+	assert.ErrorMatch(err, ".*invalid type conversion of .* to \"duration\".*")
+	_, err = value.PDuration()
+	assert.ErrorMatch(err, ".*invalid type conversion of .* to \"duration\".*")
+}
+
 func TestZScan(t *testing.T) {
 	assert := asserts.NewTesting(t, asserts.FailStop)
 	conn, restore := connectDatabase(t, assert)
@@ -326,6 +928,175 @@ func TestZScan(t *testing.T) {
 	assert.Equal(valueCount, 26*26)
 }
 
+func TestScanIterator(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	conn, restore := connectDatabase(t, assert)
+	defer restore()
+
+	for i := 0; i < 3000; i++ {
+		conn.Do("set", fmt.Sprintf("scan:%04d", i), i)
+	}
+	conn.Do("set", "other", 0)
+
+	// Keys may be returned more than once.
+	keys := map[string]bool{}
+	it := conn.Scan("scan:*", 100)
+	for it.Next() {
+		keys[it.Key()] = true
+	}
+	assert.Nil(it.Err())
+	assert.Length(keys, 3000)
+	for i := 0; i < 3000; i++ {
+		assert.True(keys[fmt.Sprintf("scan:%04d", i)])
+	}
+
+	count := 0
+	it = conn.Scan("", 0)
+	for it.Next() {
+		count++
+	}
+	assert.Nil(it.Err())
+	assert.True(count >= 3001)
+}
+
+func TestScanAll(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	conn, restore := connectDatabase(t, assert)
+	defer restore()
+
+	expected := map[string]bool{}
+	for i := 0; i < 500; i++ {
+		key := fmt.Sprintf("scanall:%03d", i)
+		conn.Do("set", key, i)
+		expected[key] = true
+	}
+	conn.Do("set", "other", 0)
+
+	keys, err := conn.ScanAll("scanall:*", 50, 0)
+	assert.Nil(err)
+	assert.Length(keys, 500)
+	for _, key := range keys {
+		assert.True(expected[key])
+		delete(expected, key)
+	}
+	assert.Length(expected, 0)
+
+	keys, err = conn.ScanAll("scanall:*", 50, 500)
+	assert.Nil(err)
+	assert.Length(keys, 500)
+
+	keys, err = conn.ScanAll("", 0, 100)
+	assert.ErrorMatch(err, ".*scan exceeds limit of 100 keys.*")
+	assert.Nil(keys)
+}
+
+func TestFieldScanIterators(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	conn, restore := connectDatabase(t, assert)
+	defer restore()
+
+	for i := 0; i < 3000; i++ {
+		field := fmt.Sprintf("field:%04d", i)
+		conn.Do("hset", "scan:hash", field, i)
+		conn.Do("sadd", "scan:set", field)
+		conn.Do("zadd", "scan:sorted-set", i, field)
+	}
+
+	fields := map[string]int{}
+	it := conn.HScan("scan:hash", "field:*", 100)
+	for it.Next() {
+		value, err := it.Value().Int()
+		assert.Nil(err)
+		fields[it.Key()] = value
+	}
+	assert.Nil(it.Err())
+	assert.Length(fields, 3000)
+	assert.Equal(fields["field:1234"], 1234)
+
+	members := map[string]bool{}
+	it = conn.SScan("scan:set", "", 100)
+	for it.Next() {
+		members[it.Key()] = true
+		assert.Nil(it.Value())
+	}
+	assert.Nil(it.Err())
+	assert.Length(members, 3000)
+
+	scores := map[string]float64{}
+	it = conn.ZScan("scan:sorted-set", "", 100)
+	for it.Next() {
+		score, err := it.Score()
+		assert.Nil(err)
+		scores[it.Key()] = score
+	}
+	assert.Nil(it.Err())
+	assert.Length(scores, 3000)
+	assert.Equal(scores["field:2999"], 2999.0)
+}
+
+func TestStreams(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	conn, restore := connectDatabase(t, assert)
+	defer restore()
+
+	ids := []string{}
+	for i := 0; i < 5; i++ {
+		id, err := conn.XAdd("stream", "", redis.NewHash().Set("index", i).Set("name", fmt.Sprintf("entry-%d", i)))
+		assert.Nil(err)
+		ids = append(ids, id)
+	}
+	_, err := conn.XAdd("stream", "", redis.NewHash())
+	assert.ErrorMatch(err, ".*stream entry needs fields.*")
+
+	// Read back in order.
+	entries, err := conn.XRange("stream", "-", "+", 0)
+	assert.Nil(err)
+	assert.Length(entries, 5)
+	for i, entry := range entries {
+		assert.Equal(entry.ID, ids[i])
+		index, err := entry.Fields.Int("index")
+		assert.Nil(err)
+		assert.Equal(index, i)
+		name, err := entry.Fields.String("name")
+		assert.Nil(err)
+		assert.Equal(name, fmt.Sprintf("entry-%d", i))
+	}
+	entries, err = conn.XRange("stream", ids[1], "+", 2)
+	assert.Nil(err)
+	assert.Length(entries, 2)
+	assert.Equal(entries[0].ID, ids[1])
+	assert.Equal(entries[1].ID, ids[2])
+
+	// Read following entries without and with blocking.
+	streams, err := conn.XRead(map[string]string{"stream": ids[2]}, 0, -1)
+	assert.Nil(err)
+	assert.Length(streams["stream"], 2)
+	assert.Equal(streams["stream"][0].ID, ids[3])
+	streams, err = conn.XRead(map[string]string{"stream": "$"}, 0, testTimeout)
+	assert.Nil(err)
+	assert.Length(streams, 0)
+
+	db, err := redis.Open(redis.TCPConnection("", testTimeout), redis.Index(testDatabaseIndex, ""))
+	assert.Nil(err)
+	defer db.Close()
+	added := make(chan string, 1)
+	go func() {
+		time.Sleep(testTimeout)
+		addConn, err := db.Connection()
+		if err != nil {
+			added <- ""
+			return
+		}
+		defer addConn.Return()
+		id, _ := addConn.XAdd("stream", "", redis.NewHash().Set("index", 5))
+		added <- id
+	}()
+	streams, err = conn.XRead(map[string]string{"stream": ids[4]}, 1, 5*time.Second)
+	assert.Nil(err)
+	assert.Length(streams["stream"], 1)
+	assert.Equal(streams["stream"][0].ID, <-added)
+}
+
 func TestTransactionConnection(t *testing.T) {
 	assert := asserts.NewTesting(t, asserts.FailStop)
 	conn, restore := connectDatabase(t, assert)
@@ -381,6 +1152,100 @@ func TestTransactionConnection(t *testing.T) {
 	assert.Equal(valueH, 99)
 }
 
+func TestReset(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	db, err := redis.Open(redis.TCPConnection("", testTimeout), redis.Index(testDatabaseIndex, ""), redis.PoolSize(2))
+	assert.Nil(err)
+	defer db.Close()
+	connA, err := db.Connection()
+	assert.Nil(err)
+	connB, err := db.Connection()
+	assert.Nil(err)
+	defer connB.Return()
+
+	// Transaction works after resetting the watch.
+	err = connA.Watch("reset:key")
+	assert.Nil(err)
+	err = connA.Reset()
+	assert.Nil(err)
+	_, err = connB.Do("set", "reset:key", 1)
+	assert.Nil(err)
+	_, err = connA.Do("multi")
+	assert.Nil(err)
+	_, err = connA.Do("set", "reset:key", 2)
+	assert.Nil(err)
+	result, err := connA.Do("exec")
+	assert.Nil(err)
+	assertEqualString(assert, result, 0, "+OK")
+
+	// Returning resets the watch automatically.
+	err = connA.Watch("reset:key")
+	assert.Nil(err)
+	assert.Nil(connA.Return())
+	_, err = connB.Do("set", "reset:key", 3)
+	assert.Nil(err)
+	connA, err = db.Connection()
+	assert.Nil(err)
+	defer connA.Return()
+	assert.Equal(db.Stats().Created, 2)
+	_, err = connA.Do("multi")
+	assert.Nil(err)
+	_, err = connA.Do("set", "reset:key", 4)
+	assert.Nil(err)
+	result, err = connA.Do("exec")
+	assert.Nil(err)
+	assertEqualString(assert, result, 0, "+OK")
+	value, err := connB.DoInt("get", "reset:key")
+	assert.Nil(err)
+	assert.Equal(value, 4)
+}
+
+func TestDoTransaction(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	db, err := redis.Open(redis.TCPConnection("", testTimeout), redis.Index(testDatabaseIndex, ""))
+	assert.Nil(err)
+	defer db.Close()
+	conn, err := db.Connection()
+	assert.Nil(err)
+	defer conn.Return()
+	_, err = conn.Do("set", "cas:counter", 10)
+	assert.Nil(err)
+
+	// First attempt is disturbed by a concurrent increment.
+	attempts := 0
+	result, err := db.DoTransaction([]string{"cas:counter"}, func(tx *redis.Transaction) error {
+		attempts++
+		counter, err := tx.Connection().DoInt("get", "cas:counter")
+		if err != nil {
+			return err
+		}
+		if attempts == 1 {
+			if _, err := conn.Do("incr", "cas:counter"); err != nil {
+				return err
+			}
+		}
+		return tx.Do("set", "cas:counter", counter*2)
+	})
+	assert.Nil(err)
+	assert.Length(result, 1)
+	assert.Equal(attempts, 2)
+	counter, err := conn.DoInt("get", "cas:counter")
+	assert.Nil(err)
+	assert.Equal(counter, 22)
+
+	// Failing function discards the transaction.
+	_, err = db.DoTransaction([]string{"cas:counter"}, func(tx *redis.Transaction) error {
+		if err := tx.Do("set", "cas:counter", 0); err != nil {
+			return err
+		}
+		return failure.New("ouch")
+	})
+	assert.ErrorMatch(err, ".*ouch.*")
+	counter, err = conn.DoInt("get", "cas:counter")
+	assert.Nil(err)
+	assert.Equal(counter, 22)
+}
+
 func TestTransactionPipeline(t *testing.T) {
 	assert := asserts.NewTesting(t, asserts.FailStop)
 	conn, connRestore := connectDatabase(t, assert)
@@ -446,6 +1311,58 @@ func TestTransactionPipelineWatch(t *testing.T) {
 	assert.Equal(valueB, 99)
 }
 
+func TestPipelineMultiExec(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	conn, connRestore := connectDatabase(t, assert)
+	defer connRestore()
+	ppl, pplRestore := pipelineDatabase(t, assert)
+	defer pplRestore()
+
+	err := ppl.Do("set", "pipeline:a", 0)
+	assert.Nil(err)
+	err = ppl.Exec()
+	assert.ErrorMatch(err, ".*no pipelined transaction started.*")
+	err = ppl.Multi()
+	assert.Nil(err)
+	err = ppl.Multi()
+	assert.ErrorMatch(err, ".*pipelined transaction already started.*")
+	ppl.Do("set", "pipeline:a", 1)
+	ppl.Do("set", "pipeline:b", 2)
+	ppl.Do("incr", "pipeline:b")
+	err = ppl.Do("exec")
+	assert.ErrorMatch(err, ".*use Exec.*")
+	err = ppl.Exec()
+	assert.Nil(err)
+	ppl.Do("get", "pipeline:b")
+	results, err := ppl.Collect()
+	assert.Nil(err)
+	assert.Length(results, 5)
+	assertEqualString(assert, results[0], 0, "+OK")
+	assertEqualString(assert, results[1], 0, "+OK")
+	assertEqualString(assert, results[2], 0, "+OK")
+	valueB, err := results[3].IntAt(0)
+	assert.Nil(err)
+	assert.Equal(valueB, 3)
+	assertEqualString(assert, results[4], 0, "3")
+
+	// Failing queuing aborts the transaction.
+	ppl.Multi()
+	ppl.Do("set", "pipeline:c", 1)
+	ppl.Do("set", "pipeline:c")
+	ppl.Exec()
+	_, err = ppl.Collect()
+	assert.ErrorMatch(err, ".*cannot queue command.*")
+	valueC, err := conn.DoValue("get", "pipeline:c")
+	assert.Nil(err)
+	assert.True(valueC.IsNil())
+
+	// Unfinished transaction.
+	ppl.Multi()
+	ppl.Do("set", "pipeline:d", 1)
+	_, err = ppl.Collect()
+	assert.ErrorMatch(err, ".*pipelined transaction not executed.*")
+}
+
 func TestScripting(t *testing.T) {
 	assert := asserts.NewTesting(t, asserts.FailStop)
 	conn, restore := connectDatabase(t, assert)
@@ -483,6 +1400,39 @@ func TestScripting(t *testing.T) {
 	assert.Equal(reply3, "+x")
 }
 
+func TestScript(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	conn, restore := connectDatabase(t, assert)
+	defer restore()
+
+	ok, err := conn.DoOK("script", "flush")
+	assert.Nil(err)
+	assert.True(ok)
+
+	script := redis.NewScript("return redis.call('incrby', KEYS[1], ARGV[1])")
+	assert.Equal(script.SHA(), "65b45e1e1b8b36c8c3e885080b88ae484e64fde6")
+	exists, err := conn.DoInt("script", "exists", script.SHA())
+	assert.Nil(err)
+	assert.Equal(exists, 0)
+
+	// First run loads the script.
+	result, err := script.Run(conn, []string{"script:counter"}, 5)
+	assert.Nil(err)
+	counter, err := result.IntAt(0)
+	assert.Nil(err)
+	assert.Equal(counter, 5)
+	exists, err = conn.DoInt("script", "exists", script.SHA())
+	assert.Nil(err)
+	assert.Equal(exists, 1)
+
+	// Following runs use the cached script.
+	result, err = script.Run(conn, []string{"script:counter"}, 10)
+	assert.Nil(err)
+	counter, err = result.IntAt(0)
+	assert.Nil(err)
+	assert.Equal(counter, 15)
+}
+
 func TestPubSub(t *testing.T) {
 	assert := asserts.NewTesting(t, asserts.FailStop)
 	conn, connRestore := connectDatabase(t, assert)
@@ -524,4 +1474,164 @@ func TestPubSub(t *testing.T) {
 	}
 }
 
+func TestPubSubUnsubscribe(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	conn, connRestore := connectDatabase(t, assert)
+	defer connRestore()
+	sub, subRestore := subscribeDatabase(t, assert)
+	defer subRestore()
+
+	err := sub.Subscribe("unsub:a", "unsub:b", "unsub:c")
+	assert.Nil(err)
+	for i := 1; i <= 3; i++ {
+		msg, err := sub.Receive()
+		assert.Nil(err)
+		assert.Equal(msg.Kind, "subscribe")
+		assert.Equal(msg.Count, i)
+	}
+
+	// Message published before unsubscribing still arrives.
+	receivers, err := conn.DoInt("publish", "unsub:b", "before")
+	assert.Nil(err)
+	assert.Equal(receivers, 1)
+	err = sub.Unsubscribe("unsub:b")
+	assert.Nil(err)
+	msg, err := sub.Receive()
+	assert.Nil(err)
+	assert.Equal(msg.Kind, "message")
+	assert.Equal(msg.Payload.String(), "before")
+	msg, err = sub.Receive()
+	assert.Nil(err)
+	assert.Equal(msg.Kind, "unsubscribe")
+	assert.Equal(msg.Channel, "unsub:b")
+	assert.Equal(msg.Count, 2)
+
+	// No more messages for the unsubscribed channel.
+	for _, channel := range []string{"unsub:a", "unsub:b", "unsub:c"} {
+		_, err := conn.DoInt("publish", channel, channel)
+		assert.Nil(err)
+	}
+	msg, err = sub.Receive()
+	assert.Nil(err)
+	assert.Equal(msg.Channel, "unsub:a")
+	msg, err = sub.Receive()
+	assert.Nil(err)
+	assert.Equal(msg.Channel, "unsub:c")
+
+	// Patterns separately.
+	err = sub.PSubscribe("unsub:*")
+	assert.Nil(err)
+	msg, err = sub.Receive()
+	assert.Nil(err)
+	assert.Equal(msg.Kind, "psubscribe")
+	assert.Equal(msg.Count, 3)
+	err = sub.PUnsubscribe("unsub:*")
+	assert.Nil(err)
+	msg, err = sub.Receive()
+	assert.Nil(err)
+	assert.Equal(msg.Kind, "punsubscribe")
+	assert.Equal(msg.Pattern, "unsub:*")
+	assert.Equal(msg.Count, 2)
+}
+
+func TestPubSubPattern(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	conn, connRestore := connectDatabase(t, assert)
+	defer connRestore()
+	sub, subRestore := subscribeDatabase(t, assert)
+	defer subRestore()
+
+	err := sub.Subscribe("pubsub:exact")
+	assert.Nil(err)
+	msg, err := sub.Receive()
+	assert.Nil(err)
+	assert.Equal(msg.Kind, "subscribe")
+	assert.Equal(msg.Channel, "pubsub:exact")
+	assert.Equal(msg.Count, 1)
+
+	err = sub.Subscribe("pubsub:pattern:*")
+	assert.Nil(err)
+	msg, err = sub.Receive()
+	assert.Nil(err)
+	assert.Equal(msg.Kind, "psubscribe")
+	assert.Equal(msg.Pattern, "pubsub:pattern:*")
+	assert.Equal(msg.Count, 2)
+
+	// Exact channel.
+	_, err = conn.Do("publish", "pubsub:exact", "foo")
+	assert.Nil(err)
+	msg, err = sub.Receive()
+	assert.Nil(err)
+	assert.Equal(msg.Kind, "message")
+	assert.Equal(msg.Channel, "pubsub:exact")
+	assert.Equal(msg.Pattern, "")
+	assert.Equal(msg.Payload.String(), "foo")
+
+	// Pattern.
+	_, err = conn.Do("publish", "pubsub:pattern:a", "bar")
+	assert.Nil(err)
+	msg, err = sub.Receive()
+	assert.Nil(err)
+	assert.Equal(msg.Kind, "pmessage")
+	assert.Equal(msg.Channel, "pubsub:pattern:a")
+	assert.Equal(msg.Pattern, "pubsub:pattern:*")
+	assert.Equal(msg.Payload.String(), "bar")
+
+	// Pop returns the real channel too.
+	_, err = conn.Do("publish", "pubsub:pattern:b", "baz")
+	assert.Nil(err)
+	pv, err := sub.Pop()
+	assert.Nil(err)
+	assert.Equal(pv.Kind, "pmessage")
+	assert.Equal(pv.Channel, "pubsub:pattern:b")
+	assert.Equal(pv.Value.String(), "baz")
+}
+
+func TestPubSubChannel(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	conn, connRestore := connectDatabase(t, assert)
+	defer connRestore()
+	sub, subRestore := subscribeDatabase(t, assert)
+	defer subRestore()
+
+	err := sub.Subscribe("pubsub:channel")
+	assert.Nil(err)
+	messages := sub.Channel()
+	msg := <-messages
+	assert.Equal(msg.Kind, "subscribe")
+	assert.Equal(msg.Channel, "pubsub:channel")
+	assert.Equal(msg.Count, 1)
+
+	_, err = sub.Pop()
+	assert.ErrorMatch(err, ".*delivers via channel.*")
+
+	go func() {
+		for i := 0; i < 10; i++ {
+			receivers, err := conn.DoInt("publish", "pubsub:channel", i)
+			assert.Nil(err)
+			assert.Equal(receivers, 1)
+		}
+	}()
+
+	for i := 0; i < 10; i++ {
+		select {
+		case msg := <-messages:
+			assert.Equal(msg.Kind, "message")
+			assert.Equal(msg.Channel, "pubsub:channel")
+			value, err := msg.Payload.Int()
+			assert.Nil(err)
+			assert.Equal(value, i)
+		case <-time.After(time.Second):
+			assert.Fail("timeout waiting for message")
+		}
+	}
+
+	// Closing ends the delivery.
+	err = sub.Close()
+	assert.Nil(err)
+	_, ok := <-messages
+	assert.False(ok)
+	assert.Nil(sub.Err())
+}
+
 // EOF
@@ -12,7 +12,10 @@ package redis // import "tideland.dev/go/db/redis"
 //--------------------
 
 import (
+	"context"
 	"strings"
+	"sync"
+	"time"
 
 	"tideland.dev/go/trace/failure"
 )
@@ -25,11 +28,13 @@ import (
 type Connection struct {
 	database *Database
 	resp     *resp
+	watching bool
+	multi    bool
 }
 
 // newConnection creates a new connection instance.
 func newConnection(db *Database) (*Connection, error) {
-	r, err := db.pool.pullRetry()
+	r, err := db.pool.pullHealthy()
 	if err != nil {
 		return nil, err
 	}
@@ -48,6 +53,11 @@ func newConnection(db *Database) (*Connection, error) {
 		conn.database.pool.kill(conn.resp)
 		return nil, err
 	}
+	err = conn.resp.setClientName()
+	if err != nil {
+		conn.database.pool.kill(conn.resp)
+		return nil, err
+	}
 	return conn, nil
 }
 
@@ -55,15 +65,61 @@ func newConnection(db *Database) (*Connection, error) {
 // the result as result set.
 func (conn *Connection) Do(cmd string, args ...interface{}) (*ResultSet, error) {
 	cmd = strings.ToLower(cmd)
-	if strings.Contains(cmd, "subscribe") {
-		return nil, failure.New("use subscription type for subscriptions")
+	if err := conn.checkCommand(cmd); err != nil {
+		return nil, err
 	}
-	err := conn.resp.sendCommand(cmd, args...)
-	logCommand(cmd, args, err, conn.database.logging)
-	if err != nil {
+	result, err := conn.do(cmd, args...)
+	for i := 0; i < conn.database.retries && err != nil && conn.retryable(cmd, err); i++ {
+		if rerr := conn.reconnect(); rerr != nil {
+			return nil, rerr
+		}
+		result, err = conn.do(cmd, args...)
+	}
+	return result, err
+}
+
+// DoContext executes one Redis command like Do but can be cancelled
+// by the passed context, also during blocking commands like BLPOP.
+// In this case the context error is returned and the connection is
+// closed, so it has not to be returned after usage anymore. The
+// command is not retried on a broken connection.
+func (conn *Connection) DoContext(ctx context.Context, cmd string, args ...interface{}) (*ResultSet, error) {
+	cmd = strings.ToLower(cmd)
+	if err := conn.checkCommand(cmd); err != nil {
 		return nil, err
 	}
-	result, err := conn.resp.receiveResultSet()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r := conn.resp
+	deadline, hasDeadline := ctx.Deadline()
+	r.deadline = deadline
+	defer func() { r.deadline = time.Time{} }()
+	// Abort blocking reads or writes in case of cancellation.
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case <-ctx.Done():
+			r.abort()
+		case <-done:
+		}
+	}()
+	result, err := conn.do(cmd, args...)
+	close(done)
+	wg.Wait()
+	ctxErr := ctx.Err()
+	if ctxErr == nil && err != nil && hasDeadline && !time.Now().Before(deadline) {
+		ctxErr = context.DeadlineExceeded
+	}
+	if ctxErr != nil {
+		// State of the protocol is unknown, so don't reuse it.
+		conn.database.pool.kill(r)
+		conn.resp = nil
+		return nil, ctxErr
+	}
 	return result, err
 }
 
@@ -106,6 +162,27 @@ func (conn *Connection) DoInt(cmd string, args ...interface{}) (int, error) {
 	return result.IntAt(0)
 }
 
+// DoFloat executes one Redis command and interpretes
+// the result as float64 value.
+func (conn *Connection) DoFloat(cmd string, args ...interface{}) (float64, error) {
+	result, err := conn.Do(cmd, args...)
+	if err != nil {
+		return 0.0, err
+	}
+	return result.FloatAt(0)
+}
+
+// DoFloats executes one Redis command and interpretes the
+// result as slice of float64 values. Nil values like those of
+// missing members in ZMSCORE are returned as NaN.
+func (conn *Connection) DoFloats(cmd string, args ...interface{}) ([]float64, error) {
+	result, err := conn.Do(cmd, args...)
+	if err != nil {
+		return nil, err
+	}
+	return result.Floats()
+}
+
 // DoString executes one Redis command and interpretes
 // the result as string value.
 func (conn *Connection) DoString(cmd string, args ...interface{}) (string, error) {
@@ -126,6 +203,17 @@ func (conn *Connection) DoStrings(cmd string, args ...interface{}) ([]string, er
 	return result.Strings(), nil
 }
 
+// DoByteSlices executes one Redis command and returns the
+// values as raw byte slices, e.g. for binary data like gob
+// or protobuf encoded blobs.
+func (conn *Connection) DoByteSlices(cmd string, args ...interface{}) ([][]byte, error) {
+	result, err := conn.Do(cmd, args...)
+	if err != nil {
+		return nil, err
+	}
+	return result.Bytes()
+}
+
 // DoKeyValues executes on Redis command and interpretes
 // the result as a list of keys and values.
 func (conn *Connection) DoKeyValues(cmd string, args ...interface{}) (KeyValues, error) {
@@ -146,6 +234,16 @@ func (conn *Connection) DoHash(cmd string, args ...interface{}) (Hash, error) {
 	return result.Hash()
 }
 
+// DoScanStruct executes one Redis command and sets the fields of
+// the struct dest points to with the returned hash.
+func (conn *Connection) DoScanStruct(dest interface{}, cmd string, args ...interface{}) error {
+	result, err := conn.Do(cmd, args...)
+	if err != nil {
+		return err
+	}
+	return result.ScanStruct(dest)
+}
+
 // DoScoredValues executes on Redis command and interpretes
 // the result as scored values.
 func (conn *Connection) DoScoredValues(cmd string, args ...interface{}) (ScoredValues, error) {
@@ -176,8 +274,152 @@ func (conn *Connection) DoScan(cmd string, args ...interface{}) (int, *ResultSet
 	return result.Scanned()
 }
 
-// Return passes the connection back into the database pool.
+// DoStream executes one Redis command and passes the values of its
+// reply one by one to the function instead of collecting them in a
+// result set. So the memory is bounded for large replies like those
+// of LRANGE or SMEMBERS. Values of nested arrays are passed flattened.
+// If the function returns an error the remaining values are skipped
+// and the error is returned.
+func (conn *Connection) DoStream(fn func(Value) error, cmd string, args ...interface{}) error {
+	cmd = strings.ToLower(cmd)
+	if strings.Contains(cmd, "subscribe") {
+		return failure.New("use subscription type for subscriptions")
+	}
+	if conn.resp == nil {
+		return failure.New("connection is closed")
+	}
+	err := conn.resp.sendCommand(cmd, args...)
+	logCommand(cmd, args, err, conn.database.logging)
+	if err != nil {
+		return err
+	}
+	return conn.resp.receiveStream(fn)
+}
+
+// checkCommand checks if the command can be executed
+// on this connection.
+func (conn *Connection) checkCommand(cmd string) error {
+	if strings.Contains(cmd, "subscribe") {
+		return failure.New("use subscription type for subscriptions")
+	}
+	if conn.resp == nil {
+		return failure.New("connection is closed")
+	}
+	return nil
+}
+
+// do sends the command and receives its result.
+func (conn *Connection) do(cmd string, args ...interface{}) (*ResultSet, error) {
+	err := conn.resp.sendCommand(cmd, args...)
+	logCommand(cmd, args, err, conn.database.logging)
+	if err != nil {
+		return nil, err
+	}
+	// Note state which must not be left for the next user.
+	switch cmd {
+	case "watch":
+		conn.watching = true
+	case "unwatch":
+		conn.watching = conn.watching && conn.multi
+	case "multi":
+		conn.multi = true
+	case "exec", "discard":
+		conn.watching = false
+		conn.multi = false
+	}
+	return conn.resp.receiveResultSet()
+}
+
+// retryable checks if the command failed due to a broken connection
+// and may be sent again. Commands while keys are watched or a transaction
+// is open are not retried, their state would be lost on a new connection.
+func (conn *Connection) retryable(cmd string, err error) bool {
+	if !failure.Contains(err, "connection is broken") {
+		return false
+	}
+	if conn.watching || conn.multi {
+		return false
+	}
+	return idempotentCommands[cmd] || conn.database.retryCommands[cmd]
+}
+
+// reconnect replaces the broken protocol by a new one.
+func (conn *Connection) reconnect() error {
+	index := conn.resp.index
+	conn.database.pool.kill(conn.resp)
+	conn.resp = nil
+	r, err := conn.database.pool.pullForced()
+	if err != nil {
+		return err
+	}
+	if err = r.authenticate(); err == nil {
+		err = r.selectDatabase()
+	}
+	if err == nil {
+		err = r.setClientName()
+	}
+	if err == nil && index != r.index {
+		err = r.selectIndex(index)
+	}
+	if err != nil {
+		conn.database.pool.kill(r)
+		return err
+	}
+	conn.resp = r
+	return nil
+}
+
+// Select switches the connection to the database with the given
+// index. It is also kept if the connection is reestablished, but
+// the next retrieval from the pool selects the configured index.
+func (conn *Connection) Select(index int) error {
+	if index < 0 {
+		return failure.New("invalid database index %d", index)
+	}
+	if conn.resp == nil {
+		return failure.New("connection is closed")
+	}
+	return conn.resp.selectIndex(index)
+}
+
+// Reset returns the connection into its initial state with RESET.
+// Subscriptions, watched keys, and transactions are dropped. Afterwards
+// it is authenticated and the configured database is selected again.
+// It needs Redis 6.2 or later.
+func (conn *Connection) Reset() error {
+	if conn.resp == nil {
+		return failure.New("connection is closed")
+	}
+	value, err := conn.DoValue("reset")
+	if err != nil {
+		return err
+	}
+	if value.String() != "+RESET" {
+		return failure.New("cannot reset connection: %v", value)
+	}
+	conn.watching = false
+	conn.multi = false
+	if err = conn.resp.authenticate(); err != nil {
+		return err
+	}
+	return conn.resp.selectDatabase()
+}
+
+// Return passes the connection back into the database pool. If
+// it has been used for watching keys or a transaction it is reset
+// before. If this fails it is closed instead.
 func (conn *Connection) Return() error {
+	if conn.resp == nil {
+		// Already closed after a cancelled command.
+		return nil
+	}
+	if conn.watching || conn.multi {
+		if err := conn.Reset(); err != nil {
+			conn.database.pool.kill(conn.resp)
+			conn.resp = nil
+			return nil
+		}
+	}
 	err := conn.database.pool.push(conn.resp)
 	conn.resp = nil
 	return err
@@ -0,0 +1,74 @@
+// Tideland Go Database Clients - Redis Client
+//
+// Copyright (C) 2017-2020 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redis // import "tideland.dev/go/db/redis"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"time"
+
+	"tideland.dev/go/trace/failure"
+)
+
+//--------------------
+// HASH FIELD EXPIRATION
+//--------------------
+
+// HExpire sets the time to live of the fields of the hash with the
+// key. Durations with fractions of seconds are set in milliseconds.
+// It returns a status per field: -2 if it doesn't exist, 1 if the
+// expiration is set, and 2 if the field is deleted because the TTL
+// is 0. It needs Redis 7.4 or later.
+func (conn *Connection) HExpire(key string, ttl time.Duration, fields ...string) ([]int, error) {
+	if ttl < 0 {
+		return nil, failure.New("invalid time to live %v", ttl)
+	}
+	if ttl%time.Second == 0 {
+		return conn.hfields("hexpire", key, int64(ttl/time.Second), fields)
+	}
+	return conn.hfields("hpexpire", key, int64(ttl/time.Millisecond), fields)
+}
+
+// HTTL returns the remaining time to live in seconds of the fields
+// of the hash with the key. It is -1 for fields without expiration
+// and -2 for missing ones. It needs Redis 7.4 or later.
+func (conn *Connection) HTTL(key string, fields ...string) ([]int, error) {
+	return conn.hfields("httl", key, nil, fields)
+}
+
+// hfields executes a command on hash fields returning an
+// integer per field. The optional argument precedes the fields.
+func (conn *Connection) hfields(cmd, key string, arg interface{}, fields []string) ([]int, error) {
+	if len(fields) == 0 {
+		return nil, failure.New("no fields for %s", cmd)
+	}
+	args := []interface{}{key}
+	if arg != nil {
+		args = append(args, arg)
+	}
+	args = append(args, "fields", len(fields), fields)
+	result, err := conn.Do(cmd, args...)
+	if err != nil {
+		return nil, err
+	}
+	if result.Len() != len(fields) {
+		value, _ := result.ValueAt(0)
+		return nil, failure.New("cannot execute %s: %v", cmd, value)
+	}
+	ints := make([]int, result.Len())
+	for i := range ints {
+		if ints[i], err = result.IntAt(i); err != nil {
+			return nil, err
+		}
+	}
+	return ints, nil
+}
+
+// EOF
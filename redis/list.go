@@ -0,0 +1,72 @@
+// Tideland Go Database Clients - Redis Client
+//
+// Copyright (C) 2017-2020 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redis // import "tideland.dev/go/db/redis"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"time"
+
+	"tideland.dev/go/trace/failure"
+)
+
+//--------------------
+// BLOCKING LISTS
+//--------------------
+
+// BLPop removes and returns the first value of the first non-empty
+// list of the keys together with its key. If all are empty it blocks
+// up to the timeout, 0 means forever. Fractions of seconds need Redis
+// 6 or later. If nothing can be popped in time the error is a timeout,
+// see IsTimeout(). The read timeout of the database has to be longer.
+func (conn *Connection) BLPop(timeout time.Duration, keys ...string) (string, Value, error) {
+	return conn.bpop("blpop", timeout, keys)
+}
+
+// BRPop removes and returns the last value of the first non-empty
+// list of the keys together with its key. It works like BLPop().
+func (conn *Connection) BRPop(timeout time.Duration, keys ...string) (string, Value, error) {
+	return conn.bpop("brpop", timeout, keys)
+}
+
+// bpop executes the blocking pop command.
+func (conn *Connection) bpop(cmd string, timeout time.Duration, keys []string) (string, Value, error) {
+	if len(keys) == 0 {
+		return "", nil, failure.New("no keys to pop from")
+	}
+	if timeout < 0 {
+		return "", nil, failure.New("invalid timeout %v", timeout)
+	}
+	result, err := conn.Do(cmd, keys, timeout.Seconds())
+	if err != nil {
+		return "", nil, err
+	}
+	key, err := result.StringAt(0)
+	if err != nil {
+		return "", nil, err
+	}
+	value, err := result.ValueAt(1)
+	if err != nil {
+		return "", nil, err
+	}
+	return key, value, nil
+}
+
+//--------------------
+// ERRORS
+//--------------------
+
+// IsTimeout returns true if the error signals that a blocking
+// command like BLPOP timed out without a result.
+func IsTimeout(err error) bool {
+	return failure.Contains(err, "timeout waiting for response")
+}
+
+// EOF
@@ -0,0 +1,87 @@
+// Tideland Go Database Clients - Redis Client
+//
+// Copyright (C) 2017-2020 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redis // import "tideland.dev/go/db/redis"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"strings"
+
+	"tideland.dev/go/trace/failure"
+)
+
+//--------------------
+// MONITOR
+//--------------------
+
+// Monitor opens a dedicated connection outside of the pool and sends
+// MONITOR. All commands processed by the server are streamed as lines
+// like `1339518083.107412 [0 127.0.0.1:60866] "keys" "*"` until the
+// context is cancelled or the connection breaks. Then the connection
+// is closed and the channel too.
+func (db *Database) Monitor(ctx context.Context) (<-chan string, error) {
+	r, err := newResp(db)
+	if err != nil {
+		return nil, err
+	}
+	// Waiting for commands must not time out.
+	r.readTimeout = 0
+	if err = r.authenticate(); err != nil {
+		r.close()
+		return nil, err
+	}
+	if err = r.sendCommand("monitor"); err != nil {
+		r.close()
+		return nil, err
+	}
+	result, err := r.receiveResultSet()
+	if err != nil {
+		r.close()
+		return nil, err
+	}
+	value, err := result.ValueAt(0)
+	if err != nil {
+		r.close()
+		return nil, err
+	}
+	if !value.IsOK() {
+		r.close()
+		return nil, failure.New("cannot start monitoring: %v", value)
+	}
+	linec := make(chan string, messageBufferSize)
+	go func() {
+		defer close(linec)
+		defer r.close()
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			select {
+			case <-ctx.Done():
+				r.abort()
+			case <-stop:
+			}
+		}()
+		for {
+			response := r.receiveResponse()
+			if response.kind != statusResponse {
+				return
+			}
+			select {
+			case linec <- strings.TrimPrefix(response.value().String(), "+"):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return linec, nil
+}
+
+// EOF
@@ -0,0 +1,66 @@
+// Tideland Go Database Clients - Redis Client
+//
+// Copyright (C) 2017-2020 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redis // import "tideland.dev/go/db/redis"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"time"
+
+	"tideland.dev/go/trace/failure"
+)
+
+//--------------------
+// OBJECT
+//--------------------
+
+// ObjectEncoding returns the internal encoding of the value stored
+// at the key, e.g. "listpack" or "hashtable" for hashes.
+func (conn *Connection) ObjectEncoding(key string) (string, error) {
+	value, err := conn.object("encoding", key)
+	if err != nil {
+		return "", err
+	}
+	return value.String(), nil
+}
+
+// ObjectIdleTime returns the time since the last access of the
+// value stored at the key. Redis measures it in seconds.
+func (conn *Connection) ObjectIdleTime(key string) (time.Duration, error) {
+	value, err := conn.object("idletime", key)
+	if err != nil {
+		return 0, err
+	}
+	return value.Duration()
+}
+
+// ObjectRefCount returns the number of references of the
+// value stored at the key.
+func (conn *Connection) ObjectRefCount(key string) (int, error) {
+	value, err := conn.object("refcount", key)
+	if err != nil {
+		return 0, err
+	}
+	return value.Int()
+}
+
+// object executes the OBJECT subcommand for the key.
+func (conn *Connection) object(subcommand, key string) (Value, error) {
+	value, err := conn.DoValue("object", subcommand, key)
+	if err != nil {
+		return nil, err
+	}
+	if value.IsNil() {
+		return nil, failure.New("key %q not found", key)
+	}
+	return value, nil
+}
+
+// EOF
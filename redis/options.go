@@ -12,6 +12,7 @@ package redis // import "tideland.dev/go/db/redis"
 //--------------------
 
 import (
+	"strings"
 	"time"
 
 	"tideland.dev/go/trace/failure"
@@ -27,21 +28,46 @@ const (
 	defaultNetwork  = "unix"
 	defaultTimeout  = 30 * time.Second
 	defaultIndex    = 0
+	defaultUsername = ""
 	defaultPassword = ""
 	defaultPoolSize = 10
 	defaultLogging  = false
+
+	defaultReadTimeout  = 0
+	defaultWriteTimeout = 0
+	defaultTestOnBorrow = false
+	defaultIdleTimeout  = 0
+	defaultMaxLifetime  = 0
+	defaultRetries      = 0
+	defaultNumericBools = false
+	defaultClientName   = ""
+	defaultWaitTimeout  = 5 * time.Second
+	defaultMinIdle      = 0
+	defaultKeepAlive    = 15 * time.Second
 )
 
 // Options is returned when calling Options() on Database to
 // provide information about the database configuration.
 type Options struct {
-	Address  string
-	Network  string
-	Timeout  time.Duration
-	Index    int
-	Password string
-	PoolSize int
-	Logging  bool
+	Address      string
+	Network      string
+	Timeout      time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	Index        int
+	Username     string
+	Password     string
+	PoolSize     int
+	IdleTimeout  time.Duration
+	MaxLifetime  time.Duration
+	TestOnBorrow bool
+	Retries      int
+	NumericBools bool
+	ClientName   string
+	WaitTimeout  time.Duration
+	MinIdle      int
+	KeepAlive    time.Duration
+	Logging      bool
 }
 
 // Option defines a function setting an option.
@@ -85,6 +111,45 @@ func UnixConnection(socket string, timeout time.Duration) Option {
 	}
 }
 
+// KeepAlive sets the period of the TCP keep-alive probes, so that
+// silently dropped connections, e.g. behind NAT, are detected. A
+// period of 0 disables them, the default are 15 seconds.
+func KeepAlive(period time.Duration) Option {
+	return func(d *Database) error {
+		if period < 0 {
+			return failure.New("invalid configuration value in field 'keep alive': %v", period)
+		}
+		d.keepAlive = period
+		return nil
+	}
+}
+
+// ReadTimeout sets the maximum duration for reading a response.
+// It also applies to blocking commands like BLPOP, but not to the
+// waiting for published values of a subscription. The default of
+// 0 means no timeout.
+func ReadTimeout(timeout time.Duration) Option {
+	return func(d *Database) error {
+		if timeout < 0 {
+			return failure.New("invalid configuration value in field 'read timeout': %v", timeout)
+		}
+		d.readTimeout = timeout
+		return nil
+	}
+}
+
+// WriteTimeout sets the maximum duration for sending a command.
+// The default of 0 means no timeout.
+func WriteTimeout(timeout time.Duration) Option {
+	return func(d *Database) error {
+		if timeout < 0 {
+			return failure.New("invalid configuration value in field 'write timeout': %v", timeout)
+		}
+		d.writeTimeout = timeout
+		return nil
+	}
+}
+
 // Index selects the database and sets the authentication. The
 // default database is the 0, the default password is empty.
 func Index(index int, password string) Option {
@@ -98,6 +163,20 @@ func Index(index int, password string) Option {
 	}
 }
 
+// Credentials sets the username and password for the authentication
+// at Redis 6 and later with access control lists. An empty username
+// uses the password only like Index() does.
+func Credentials(username, password string) Option {
+	return func(d *Database) error {
+		if username != "" && password == "" {
+			return failure.New("invalid configuration value in field 'password': username needs password")
+		}
+		d.username = username
+		d.password = password
+		return nil
+	}
+}
+
 // PoolSize sets the pool size of the database. The default is 10.
 func PoolSize(poolsize int) Option {
 	return func(d *Database) error {
@@ -111,4 +190,116 @@ func PoolSize(poolsize int) Option {
 	}
 }
 
+// WaitTimeout sets how long retrieving a connection waits if all pooled
+// ones are in use. After that an error is returned. A timeout of 0 lets
+// it fail immediately, the default are 5 seconds.
+func WaitTimeout(timeout time.Duration) Option {
+	return func(d *Database) error {
+		if timeout < 0 {
+			return failure.New("invalid configuration value in field 'wait timeout': %v", timeout)
+		}
+		d.waitTimeout = timeout
+		return nil
+	}
+}
+
+// MinIdle sets the number of idle connections the pool opens in
+// advance after opening the database and keeps available later. So
+// bursts don't have to wait for establishing new ones. It's limited
+// by the pool size, the default is 0.
+func MinIdle(n int) Option {
+	return func(d *Database) error {
+		if n < 0 {
+			return failure.New("invalid configuration value in field 'min idle': %v", n)
+		}
+		d.minIdle = n
+		return nil
+	}
+}
+
+// IdleTimeout sets the duration after which available connections
+// of the pool are closed if unused. The default of 0 keeps them open.
+func IdleTimeout(timeout time.Duration) Option {
+	return func(d *Database) error {
+		if timeout < 0 {
+			return failure.New("invalid configuration value in field 'idle timeout': %v", timeout)
+		}
+		d.idleTimeout = timeout
+		return nil
+	}
+}
+
+// MaxConnLifetime sets the maximum age of connections. Older ones are
+// closed when returned to the pool instead of being reused. The default
+// of 0 means no limit.
+func MaxConnLifetime(lifetime time.Duration) Option {
+	return func(d *Database) error {
+		if lifetime < 0 {
+			return failure.New("invalid configuration value in field 'max lifetime': %v", lifetime)
+		}
+		d.maxLifetime = lifetime
+		return nil
+	}
+}
+
+// RetryBrokenConn lets a connection open a new one and send a command
+// again if it failed due to a broken connection, up to n times. This
+// is only done for reading commands which don't change data. Writing
+// ones have to be explicitly allowed, but they may be executed twice
+// if the connection broke after sending.
+func RetryBrokenConn(n int, allowedCmds ...string) Option {
+	return func(d *Database) error {
+		if n < 0 {
+			return failure.New("invalid configuration value in field 'retries': %v", n)
+		}
+		d.retries = n
+		d.retryCommands = make(map[string]bool)
+		for _, cmd := range allowedCmds {
+			d.retryCommands[strings.ToLower(cmd)] = true
+		}
+		return nil
+	}
+}
+
+// TestOnBorrow lets the pool check each connection with a PING
+// before it is handed out. Broken ones, e.g. closed by the server
+// after being idle, are replaced by new ones.
+func TestOnBorrow() Option {
+	return func(d *Database) error {
+		d.testOnBorrow = true
+		return nil
+	}
+}
+
+// Logging lets all executed commands be logged, not
+// only failing ones. Passwords are masked.
+func Logging() Option {
+	return func(d *Database) error {
+		d.logging = true
+		return nil
+	}
+}
+
+// ClientName sets the name each connection registers with CLIENT
+// SETNAME. It is shown by CLIENT LIST and helps to find out which
+// service holds which connections. The name must not contain spaces.
+func ClientName(name string) Option {
+	return func(d *Database) error {
+		if strings.ContainsAny(name, " \t\r\n") {
+			return failure.New("invalid configuration value in field 'client name': %q", name)
+		}
+		d.clientName = name
+		return nil
+	}
+}
+
+// NumericBools lets boolean arguments be sent as "1" and "0" like
+// Redis itself uses them instead of the default "true" and "false".
+func NumericBools() Option {
+	return func(d *Database) error {
+		d.numericBools = true
+		return nil
+	}
+}
+
 // EOF
@@ -17,6 +17,20 @@ import (
 	"tideland.dev/go/trace/failure"
 )
 
+//--------------------
+// CONSTANTS
+//--------------------
+
+// replyKind tells how the reply of a pipelined command is collected.
+type replyKind int
+
+const (
+	plainReply replyKind = iota
+	multiReply
+	queuedReply
+	execReply
+)
+
 //--------------------
 // CONNECTION
 //--------------------
@@ -26,7 +40,9 @@ import (
 type Pipeline struct {
 	database *Database
 	resp     *resp
-	counter  int
+	replies  []replyKind
+	labels   []string
+	multi    bool
 }
 
 // newPipeline creates a new pipeline instance.
@@ -52,12 +68,36 @@ func newPipeline(db *Database) (*Pipeline, error) {
 		ppl.database.pool.kill(ppl.resp)
 		return nil, err
 	}
+	err = ppl.resp.setClientName()
+	if err != nil {
+		ppl.database.pool.kill(ppl.resp)
+		return nil, err
+	}
 	return ppl, nil
 }
 
 // Do executes one Redis command and returns
 // the result as result set.
 func (ppl *Pipeline) Do(cmd string, args ...interface{}) error {
+	return ppl.do("", cmd, args...)
+}
+
+// DoKeyed executes one Redis command like Do. Its result can be
+// retrieved by the given label when collecting with CollectMap.
+func (ppl *Pipeline) DoKeyed(label, cmd string, args ...interface{}) error {
+	if label == "" {
+		return failure.New("empty pipeline label")
+	}
+	for _, existing := range ppl.labels {
+		if existing == label {
+			return failure.New("duplicate pipeline label %q", label)
+		}
+	}
+	return ppl.do(label, cmd, args...)
+}
+
+// do executes the command and notes the label of its result.
+func (ppl *Pipeline) do(label, cmd string, args ...interface{}) error {
 	cmd = strings.ToLower(cmd)
 	if strings.Contains(cmd, "subscribe") {
 		return failure.New("use subscription type for subscriptions")
@@ -66,38 +106,167 @@ func (ppl *Pipeline) Do(cmd string, args ...interface{}) error {
 	if err != nil {
 		return err
 	}
-	err = ppl.resp.sendCommand(cmd, args...)
-	logCommand(cmd, args, err, ppl.database.logging)
+	kind := plainReply
+	if ppl.multi {
+		switch cmd {
+		case "multi", "exec", "discard":
+			return failure.New("use Exec() to finish the pipelined transaction")
+		}
+		kind = queuedReply
+	}
+	err = ppl.send(kind, cmd, args...)
+	if err != nil {
+		return err
+	}
+	ppl.labels = append(ppl.labels, label)
+	return nil
+}
+
+// Multi starts a transaction inside the pipeline. The following commands
+// are queued until Exec() is called. Collect() returns one result set
+// for each of them out of the result of EXEC, so that the results match
+// the commands like without transaction.
+func (ppl *Pipeline) Multi() error {
+	if ppl.multi {
+		return failure.New("pipelined transaction already started")
+	}
+	err := ppl.ensureProtocol()
+	if err != nil {
+		return err
+	}
+	err = ppl.send(multiReply, "multi")
+	if err != nil {
+		return err
+	}
+	ppl.multi = true
+	return nil
+}
+
+// Exec finishes the transaction started with Multi(). The queued
+// commands are executed atomically.
+func (ppl *Pipeline) Exec() error {
+	if !ppl.multi {
+		return failure.New("no pipelined transaction started")
+	}
+	err := ppl.send(execReply, "exec")
 	if err != nil {
 		return err
 	}
-	ppl.counter++
-	return err
+	ppl.multi = false
+	return nil
 }
 
 // Collect collects all the result sets of the commands and returns
-// the connection back into the pool.
+// the connection back into the pool. If a transaction has been aborted
+// the other results are read too, but only an error is returned.
 func (ppl *Pipeline) Collect() ([]*ResultSet, error) {
+	if ppl.multi {
+		ppl.Discard()
+		return nil, failure.New("pipelined transaction not executed")
+	}
 	defer func() {
 		ppl.resp = nil
+		ppl.replies = nil
+		ppl.labels = nil
 	}()
 	err := ppl.ensureProtocol()
 	if err != nil {
 		return nil, err
 	}
 	results := []*ResultSet{}
-	for i := ppl.counter; i > 0; i-- {
+	var queueErr, txErr error
+	for _, kind := range ppl.replies {
 		result, err := ppl.resp.receiveResultSet()
+		if kind == execReply && err != nil && failure.Contains(err, "timeout waiting for response") {
+			// EXEC answers with a null array if aborted.
+			txErr = failure.New(msgWatchedKeysChanged)
+			continue
+		}
 		if err != nil {
 			ppl.database.pool.kill(ppl.resp)
 			return nil, err
 		}
-		results = append(results, result)
+		switch kind {
+		case plainReply:
+			results = append(results, result)
+		case multiReply, queuedReply:
+			value, err := result.ValueAt(0)
+			if err != nil {
+				ppl.database.pool.kill(ppl.resp)
+				return nil, err
+			}
+			if value.String() != "+OK" && value.String() != "+QUEUED" && queueErr == nil {
+				queueErr = failure.New("cannot queue command: %v", value)
+			}
+		case execReply:
+			if queueErr != nil {
+				// EXEC answers with EXECABORT.
+				txErr = queueErr
+				queueErr = nil
+				continue
+			}
+			for _, item := range result.items {
+				switch typedItem := item.(type) {
+				case *ResultSet:
+					typedItem.parent = nil
+					results = append(results, typedItem)
+				case Value:
+					commandResult := newResultSet()
+					commandResult.append(typedItem)
+					results = append(results, commandResult)
+				}
+			}
+		}
 	}
 	ppl.database.pool.push(ppl.resp)
+	if txErr != nil {
+		return nil, txErr
+	}
 	return results, nil
 }
 
+// CollectMap collects the result sets like Collect but returns those
+// of the commands executed with DoKeyed mapped by their labels. The
+// results of the commands executed with Do are dropped.
+func (ppl *Pipeline) CollectMap() (map[string]*ResultSet, error) {
+	labels := ppl.labels
+	results, err := ppl.Collect()
+	if err != nil {
+		return nil, err
+	}
+	if len(results) != len(labels) {
+		return nil, failure.New("received %d results for %d commands", len(results), len(labels))
+	}
+	labeled := make(map[string]*ResultSet)
+	for i, label := range labels {
+		if label != "" {
+			labeled[label] = results[i]
+		}
+	}
+	return labeled, nil
+}
+
+// Discard drops the pipeline without reading the responses of the
+// commands and returns the connection back into the pool. As those
+// are pending it is closed in that case. Be aware that the commands
+// are already sent and so possibly executed. The pipeline can be
+// used again afterwards.
+func (ppl *Pipeline) Discard() error {
+	if ppl.resp == nil {
+		return nil
+	}
+	defer func() {
+		ppl.resp = nil
+		ppl.replies = nil
+		ppl.labels = nil
+		ppl.multi = false
+	}()
+	if len(ppl.replies) == 0 {
+		return ppl.database.pool.push(ppl.resp)
+	}
+	return ppl.database.pool.kill(ppl.resp)
+}
+
 // ensureProtocol retrieves a protocol from the pool if needed.
 func (ppl *Pipeline) ensureProtocol() error {
 	if ppl.resp == nil {
@@ -106,8 +275,20 @@ func (ppl *Pipeline) ensureProtocol() error {
 			return err
 		}
 		ppl.resp = p
-		ppl.counter = 0
+		ppl.replies = nil
+		ppl.labels = nil
+	}
+	return nil
+}
+
+// send sends the command and notes how to collect its reply.
+func (ppl *Pipeline) send(kind replyKind, cmd string, args ...interface{}) error {
+	err := ppl.resp.sendCommand(cmd, args...)
+	logCommand(cmd, args, err, ppl.database.logging)
+	if err != nil {
+		return err
 	}
+	ppl.replies = append(ppl.replies, kind)
 	return nil
 }
 
@@ -17,12 +17,30 @@ import (
 
 	"tideland.dev/go/together/wait"
 	"tideland.dev/go/trace/failure"
+	"tideland.dev/go/trace/logger"
 )
 
+//--------------------
+// CONSTANTS
+//--------------------
+
+// maintenanceInterval is the interval for replenishing the minimum
+// of idle connections if no idle timeout defines it.
+const maintenanceInterval = 10 * time.Second
+
 //--------------------
 // CONNECTION POOL
 //--------------------
 
+// PoolStats contains statistics of the connection pool.
+type PoolStats struct {
+	InUse     int
+	Available int
+	Created   int
+	Waits     int
+	Timeouts  int
+}
+
 // pool manages a number of Redis resp instances.
 type pool struct {
 	mu        sync.Mutex
@@ -30,6 +48,10 @@ type pool struct {
 	active    bool
 	available map[*resp]*resp
 	inUse     map[*resp]*resp
+	stop      chan struct{}
+	created   int
+	waits     int
+	timeouts  int
 }
 
 // newPool creates a connection pool with uninitialized
@@ -40,6 +62,10 @@ func newPool(db *Database) *pool {
 		active:    true,
 		available: make(map[*resp]*resp),
 		inUse:     make(map[*resp]*resp),
+		stop:      make(chan struct{}),
+	}
+	if db.idleTimeout > 0 || db.minIdle > 0 {
+		go p.maintain()
 	}
 	return p
 }
@@ -53,6 +79,7 @@ func (p *pool) close() error {
 		return failure.New("connection pool closed")
 	}
 	p.active = false
+	close(p.stop)
 	var err error
 	for resp := range p.available {
 		cerr := resp.close()
@@ -64,6 +91,26 @@ func (p *pool) close() error {
 	return err
 }
 
+// count increments one of the statistic counters.
+func (p *pool) count(counter *int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	*counter++
+}
+
+// stats returns the current statistics.
+func (p *pool) stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return PoolStats{
+		InUse:     len(p.inUse),
+		Available: len(p.available),
+		Created:   p.created,
+		Waits:     p.waits,
+		Timeouts:  p.timeouts,
+	}
+}
+
 // pullForced retrieves a new created protocol.
 func (p *pool) pullForced() (*resp, error) {
 	p.mu.Lock()
@@ -75,6 +122,7 @@ func (p *pool) pullForced() (*resp, error) {
 	if err != nil {
 		return nil, err
 	}
+	p.created++
 	p.inUse[resp] = resp
 	return resp, nil
 }
@@ -84,23 +132,58 @@ func (p *pool) pullForced() (*resp, error) {
 func (p *pool) pullRetry() (*resp, error) {
 	var r *resp
 	var err error
+	if p.database.waitTimeout == 0 {
+		// Fail immediately if exhausted.
+		r, err = p.pull()
+		if err != nil && failure.Contains(err, "connection pool limit") {
+			p.count(&p.timeouts)
+		}
+		return r, err
+	}
+	waiting := false
 	if werr := wait.WithTimeout(
 		p.database.ctx,
 		5*time.Millisecond,
-		5*time.Second,
+		p.database.waitTimeout,
 		func() (bool, error) {
 			r, err = p.pull()
 			if r != nil {
 				return true, nil
 			}
+			if !waiting {
+				waiting = true
+				p.count(&p.waits)
+			}
 			return false, nil
 		},
 	); werr != nil {
+		p.count(&p.timeouts)
 		return nil, werr
 	}
 	return r, err
 }
 
+// pullHealthy retrieves a protocol like pullRetry. If configured
+// it is checked and replaced if broken.
+func (p *pool) pullHealthy() (*resp, error) {
+	r, err := p.pullRetry()
+	if err != nil || !p.database.testOnBorrow {
+		return r, err
+	}
+	// Available ones may all be broken, so finally a new one is used.
+	for i := 0; i <= p.database.poolsize; i++ {
+		if r.ping() {
+			return r, nil
+		}
+		p.kill(r)
+		r, err = p.pullRetry()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, failure.New("cannot retrieve healthy connection")
+}
+
 // pull retrieves a protocol out of the pool.
 func (p *pool) pull() (*resp, error) {
 	p.mu.Lock()
@@ -122,6 +205,7 @@ func (p *pool) pull() (*resp, error) {
 		if err != nil {
 			return nil, err
 		}
+		p.created++
 		p.inUse[resp] = resp
 		return resp, nil
 	}
@@ -133,15 +217,109 @@ func (p *pool) push(resp *resp) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	delete(p.inUse, resp)
-	if !p.active || len(p.available) >= p.database.poolsize {
+	if !p.active || len(p.available) >= p.database.poolsize || p.expired(resp) {
 		// Simply close it.
 		return resp.close()
 	}
 	// Return to availanle ones.
+	resp.lastUsed = time.Now()
 	p.available[resp] = resp
 	return nil
 }
 
+// expired checks if the protocol exceeded its maximum lifetime.
+func (p *pool) expired(resp *resp) bool {
+	return p.database.maxLifetime > 0 && time.Since(resp.created) > p.database.maxLifetime
+}
+
+// maintain periodically closes available connections being idle
+// for too long and opens new ones down to the minimum of idle ones.
+func (p *pool) maintain() {
+	interval := maintenanceInterval
+	if p.database.idleTimeout > 0 {
+		interval = p.database.idleTimeout / 2
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	p.warmUp()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case now := <-ticker.C:
+			if p.database.idleTimeout > 0 {
+				p.reap(now)
+			}
+			p.warmUp()
+		}
+	}
+}
+
+// reap closes available connections being idle for too long, but
+// keeps the minimum of idle ones.
+func (p *pool) reap(now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for resp := range p.available {
+		if len(p.available) <= p.database.minIdle {
+			return
+		}
+		if now.Sub(resp.lastUsed) > p.database.idleTimeout {
+			delete(p.available, resp)
+			resp.close()
+		}
+	}
+}
+
+// warmUp opens, authenticates, and selects new connections until
+// the minimum of idle ones is available. Failures are only logged,
+// the next maintenance tries again.
+func (p *pool) warmUp() {
+	for {
+		p.mu.Lock()
+		missing := p.idleMissing()
+		p.mu.Unlock()
+		if !missing {
+			return
+		}
+		r, err := newResp(p.database)
+		if err == nil {
+			if err = r.authenticate(); err == nil {
+				if err = r.selectDatabase(); err == nil {
+					err = r.setClientName()
+				}
+			}
+			if err != nil {
+				r.close()
+			}
+		}
+		if err != nil {
+			logger.Warningf("cannot warm up connection pool: %v", err)
+			return
+		}
+		// Pool may have been filled or stopped meanwhile.
+		p.mu.Lock()
+		if !p.idleMissing() {
+			p.mu.Unlock()
+			r.close()
+			return
+		}
+		r.lastUsed = time.Now()
+		p.created++
+		p.available[r] = r
+		p.mu.Unlock()
+	}
+}
+
+// idleMissing returns true if the active pool has less idle
+// connections than wanted and is not yet full. The caller has
+// to hold the lock.
+func (p *pool) idleMissing() bool {
+	return p.active &&
+		len(p.available) < p.database.minIdle &&
+		len(p.available)+len(p.inUse) < p.database.poolsize
+}
+
 // kill closes the connection and removes it from the pool.
 func (p *pool) kill(resp *resp) (err error) {
 	p.mu.Lock()
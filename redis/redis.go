@@ -24,36 +24,62 @@ import (
 
 // Database provides access to a Redis database.
 type Database struct {
-	mu       sync.Mutex
-	ctx      context.Context
-	address  string
-	network  string
-	timeout  time.Duration
-	index    int
-	password string
-	poolsize int
-	logging  bool
-	pool     *pool
+	mu            sync.Mutex
+	ctx           context.Context
+	cancel        func()
+	address       string
+	network       string
+	timeout       time.Duration
+	readTimeout   time.Duration
+	writeTimeout  time.Duration
+	index         int
+	username      string
+	password      string
+	poolsize      int
+	idleTimeout   time.Duration
+	maxLifetime   time.Duration
+	testOnBorrow  bool
+	retries       int
+	retryCommands map[string]bool
+	numericBools  bool
+	clientName    string
+	waitTimeout   time.Duration
+	minIdle       int
+	keepAlive     time.Duration
+	logging       bool
+	pool          *pool
 }
 
 // Open opens the connection to a Redis database based on the
 // passed options.
 func Open(options ...Option) (*Database, error) {
 	db := &Database{
-		ctx:      context.Background(),
-		address:  defaultSocket,
-		network:  defaultNetwork,
-		timeout:  defaultTimeout,
-		index:    defaultIndex,
-		password: defaultPassword,
-		poolsize: defaultPoolSize,
-		logging:  defaultLogging,
+		address:      defaultSocket,
+		network:      defaultNetwork,
+		timeout:      defaultTimeout,
+		readTimeout:  defaultReadTimeout,
+		writeTimeout: defaultWriteTimeout,
+		index:        defaultIndex,
+		username:     defaultUsername,
+		password:     defaultPassword,
+		poolsize:     defaultPoolSize,
+		idleTimeout:  defaultIdleTimeout,
+		maxLifetime:  defaultMaxLifetime,
+		testOnBorrow: defaultTestOnBorrow,
+		retries:      defaultRetries,
+		numericBools: defaultNumericBools,
+		clientName:   defaultClientName,
+		waitTimeout:  defaultWaitTimeout,
+		minIdle:      defaultMinIdle,
+		keepAlive:    defaultKeepAlive,
+		logging:      defaultLogging,
 	}
 	for _, option := range options {
 		if err := option(db); err != nil {
 			return nil, err
 		}
 	}
+	db.ctx, db.cancel = context.WithCancel(context.Background())
 	db.pool = newPool(db)
 	return db, nil
 }
@@ -63,13 +89,25 @@ func (db *Database) Options() Options {
 	db.mu.Lock()
 	defer db.mu.Unlock()
 	return Options{
-		Address:  db.address,
-		Network:  db.network,
-		Timeout:  db.timeout,
-		Index:    db.index,
-		Password: db.password,
-		PoolSize: db.poolsize,
-		Logging:  db.logging,
+		Address:      db.address,
+		Network:      db.network,
+		Timeout:      db.timeout,
+		ReadTimeout:  db.readTimeout,
+		WriteTimeout: db.writeTimeout,
+		Index:        db.index,
+		Username:     db.username,
+		Password:     db.password,
+		PoolSize:     db.poolsize,
+		IdleTimeout:  db.idleTimeout,
+		MaxLifetime:  db.maxLifetime,
+		TestOnBorrow: db.testOnBorrow,
+		Retries:      db.retries,
+		NumericBools: db.numericBools,
+		ClientName:   db.clientName,
+		WaitTimeout:  db.waitTimeout,
+		MinIdle:      db.minIdle,
+		KeepAlive:    db.keepAlive,
+		Logging:      db.logging,
 	}
 }
 
@@ -98,8 +136,15 @@ func (db *Database) Subscription() (*Subscription, error) {
 	return newSubscription(db)
 }
 
+// Stats returns the statistics of the connection pool.
+func (db *Database) Stats() PoolStats {
+	return db.pool.stats()
+}
+
 // Close closes the database client.
 func (db *Database) Close() error {
+	// Abort running dials before waiting for them.
+	db.cancel()
 	db.mu.Lock()
 	defer db.mu.Unlock()
 	return db.pool.close()
@@ -12,6 +12,13 @@ package redis_test
 //--------------------
 
 import (
+	"bufio"
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -50,6 +57,54 @@ func BenchmarkTCPConnection(b *testing.B) {
 	}
 }
 
+func TestDoContext(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	db, err := redis.Open(redis.TCPConnection("", testTimeout), redis.Index(testDatabaseIndex, ""))
+	assert.Nil(err)
+	defer db.Close()
+
+	// Command finishing in time.
+	conn, err := db.Connection()
+	assert.Nil(err)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	result, err := conn.DoContext(ctx, "echo", "Hello, World!")
+	assert.Nil(err)
+	assertEqualString(assert, result, 0, "Hello, World!")
+
+	// Blocking command exceeding the deadline.
+	conn.Do("del", "ctx:list")
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = conn.DoContext(ctx, "blpop", "ctx:list", 0)
+	assert.Equal(err, context.DeadlineExceeded)
+	assert.True(time.Since(start) < time.Second)
+	_, err = conn.Do("ping")
+	assert.ErrorMatch(err, ".*connection is closed.*")
+	assert.Nil(conn.Return())
+
+	// Blocking command cancelled.
+	conn, err = db.Connection()
+	assert.Nil(err)
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+	_, err = conn.DoContext(ctx, "blpop", "ctx:list", 0)
+	assert.Equal(err, context.Canceled)
+	conn.Return()
+
+	// Pool still delivers working connections.
+	conn, err = db.Connection()
+	assert.Nil(err)
+	defer conn.Return()
+	result, err = conn.Do("ping")
+	assert.Nil(err)
+	assertEqualString(assert, result, 0, "+PONG")
+}
+
 func TestPipelining(t *testing.T) {
 	assert := asserts.NewTesting(t, asserts.FailStop)
 	ppl, restore := pipelineDatabase(t, assert)
@@ -69,6 +124,79 @@ func TestPipelining(t *testing.T) {
 	}
 }
 
+func TestPipelineDiscard(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	db, err := redis.Open(redis.TCPConnection("", testTimeout), redis.PoolSize(2))
+	assert.Nil(err)
+	defer db.Close()
+	ppl, err := db.Pipeline()
+	assert.Nil(err)
+	assert.Nil(ppl.Discard())
+	assert.Equal(db.Stats().InUse, 0)
+	assert.Equal(db.Stats().Available, 1)
+
+	for i := 0; i < 10; i++ {
+		err := ppl.Do("ping")
+		assert.Nil(err)
+	}
+	stats := db.Stats()
+	assert.Equal(stats.InUse, 1)
+	assert.Nil(ppl.Discard())
+	stats = db.Stats()
+	assert.Equal(stats.InUse, 0)
+	assert.Equal(stats.Available, 1)
+	assert.Nil(ppl.Discard())
+
+	// Pool is fully usable again.
+	connA, err := db.Connection()
+	assert.Nil(err)
+	defer connA.Return()
+	connB, err := db.Connection()
+	assert.Nil(err)
+	defer connB.Return()
+	result, err := connB.Do("ping")
+	assert.Nil(err)
+	assertEqualString(assert, result, 0, "+PONG")
+}
+
+func TestPipelineLabels(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	ppl, restore := pipelineDatabase(t, assert)
+	defer restore()
+
+	err := ppl.DoKeyed("set", "set", "pipeline:label", 42)
+	assert.Nil(err)
+	err = ppl.Do("ping")
+	assert.Nil(err)
+	err = ppl.DoKeyed("get", "get", "pipeline:label")
+	assert.Nil(err)
+	err = ppl.DoKeyed("echo", "echo", "hello")
+	assert.Nil(err)
+	err = ppl.DoKeyed("echo", "echo", "again")
+	assert.ErrorMatch(err, ".*duplicate pipeline label \"echo\".*")
+	err = ppl.DoKeyed("", "ping")
+	assert.ErrorMatch(err, ".*empty pipeline label.*")
+
+	results, err := ppl.CollectMap()
+	assert.Nil(err)
+	assert.Length(results, 3)
+	assertEqualString(assert, results["set"], 0, "+OK")
+	value, err := results["get"].IntAt(0)
+	assert.Nil(err)
+	assert.Equal(value, 42)
+	assertEqualString(assert, results["echo"], 0, "hello")
+
+	// Labels can be used again after collecting.
+	err = ppl.DoKeyed("echo", "echo", "again")
+	assert.Nil(err)
+	err = ppl.Do("ping")
+	assert.Nil(err)
+	positional, err := ppl.Collect()
+	assert.Nil(err)
+	assert.Length(positional, 2)
+	assertEqualString(assert, positional[0], 0, "again")
+}
+
 func BenchmarkPipelining(b *testing.B) {
 	assert := asserts.NewTesting(b, asserts.FailStop)
 	ppl, restore := pipelineDatabase(nil, assert)
@@ -97,12 +225,877 @@ func TestOptions(t *testing.T) {
 	assert.Equal(options.Address, "127.0.0.1:6379")
 	assert.Equal(options.Network, "tcp")
 	assert.Equal(options.Timeout, 30*time.Second)
+	assert.Equal(options.ReadTimeout, time.Duration(0))
+	assert.Equal(options.WriteTimeout, time.Duration(0))
 	assert.Equal(options.Index, 0)
+	assert.Equal(options.Username, "")
 	assert.Equal(options.Password, "")
 	assert.Equal(options.PoolSize, 5)
+	assert.Equal(options.KeepAlive, 15*time.Second)
 	assert.Equal(options.Logging, false)
 }
 
+func TestAuthentication(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	// Server knowing the default user and the ACL user "foo".
+	server := startFakeServer(assert, func(asking bool, args []string) string {
+		switch args[0] {
+		case "auth":
+			switch {
+			case len(args) == 2 && args[1] == "secret":
+				return "+OK\r\n"
+			case len(args) == 3 && args[1] == "foo" && args[2] == "bar":
+				return "+OK\r\n"
+			}
+			return "-WRONGPASS invalid username-password pair\r\n"
+		case "select":
+			return "+OK\r\n"
+		}
+		return "+PONG\r\n"
+	})
+	defer server.Close()
+
+	tests := []struct {
+		option redis.Option
+		ok     bool
+	}{
+		{redis.Index(0, "secret"), true},
+		{redis.Index(0, "wrong"), false},
+		{redis.Credentials("", "secret"), true},
+		{redis.Credentials("foo", "bar"), true},
+		{redis.Credentials("foo", "secret"), false},
+	}
+	for _, test := range tests {
+		db, err := redis.Open(redis.TCPConnection(addressOf(server), testTimeout), test.option)
+		assert.Nil(err)
+		conn, err := db.Connection()
+		if test.ok {
+			assert.Nil(err)
+			conn.Return()
+		} else {
+			assert.ErrorMatch(err, ".*cannot authenticate.*")
+		}
+		db.Close()
+	}
+
+	db, err := redis.Open(redis.Credentials("foo", "bar"))
+	assert.Nil(err)
+	assert.Equal(db.Options().Username, "foo")
+	assert.Equal(db.Options().Password, "bar")
+	db.Close()
+	_, err = redis.Open(redis.Credentials("foo", ""))
+	assert.ErrorMatch(err, ".*invalid configuration value in field 'password'.*")
+}
+
+func TestClientName(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	conn, restore := connectDatabase(t, assert, redis.ClientName("tideland-test"))
+	defer restore()
+
+	name, err := conn.DoString("client", "getname")
+	assert.Nil(err)
+	assert.Equal(name, "tideland-test")
+	list, err := conn.DoString("client", "list")
+	assert.Nil(err)
+	assert.Match(list, ".*name=tideland-test.*")
+
+	_, err = redis.Open(redis.ClientName("tideland test"))
+	assert.ErrorMatch(err, ".*invalid configuration value in field 'client name'.*")
+}
+
+func TestLoggingMasksPasswords(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	server := startFakeServer(assert, func(asking bool, args []string) string {
+		return "+OK\r\n"
+	})
+	defer server.Close()
+	tl := logger.NewTestLogger()
+	defer logger.SetLogger(logger.SetLogger(tl))
+
+	db, err := redis.Open(redis.TCPConnection(addressOf(server), testTimeout), redis.Logging())
+	assert.Nil(err)
+	defer db.Close()
+	assert.True(db.Options().Logging)
+	conn, err := db.Connection()
+	assert.Nil(err)
+	defer conn.Return()
+
+	_, err = conn.Do("AUTH", "secret")
+	assert.Nil(err)
+	_, err = conn.Do("auth", "foo", "secret")
+	assert.Nil(err)
+	_, err = conn.Do("hello", 3, "auth", "foo", "secret", "setname", "bar")
+	assert.Nil(err)
+	assert.Length(tl.Entries(), 3)
+	for _, entry := range tl.Entries() {
+		assert.False(strings.Contains(entry, "secret"))
+		assert.True(strings.Contains(entry, "***"))
+	}
+	assert.True(strings.Contains(tl.Entries()[2], "setname / bar"))
+}
+
+func TestMonitor(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	conn, restore := connectDatabase(t, assert)
+	defer restore()
+	db, err := redis.Open(redis.TCPConnection("", testTimeout))
+	assert.Nil(err)
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	linec, err := db.Monitor(ctx)
+	assert.Nil(err)
+	assert.Equal(db.Stats().Created, 0)
+
+	_, err = conn.Do("set", "monitor:key", "monitored")
+	assert.Nil(err)
+	found := false
+	timeout := time.After(5 * time.Second)
+	for !found {
+		select {
+		case line := <-linec:
+			found = strings.Contains(line, `"set" "monitor:key" "monitored"`)
+		case <-timeout:
+			assert.Fail("monitored command not received")
+		}
+	}
+
+	// Cancelling closes the channel.
+	cancel()
+	for range linec {
+	}
+}
+
+func TestCloseAbortsDial(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	// Unroutable address lets the dial block until its timeout.
+	db, err := redis.Open(redis.TCPConnection("10.255.255.1:6379", time.Minute))
+	assert.Nil(err)
+	errc := make(chan error, 1)
+	go func() {
+		_, err := db.Connection()
+		errc <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	start := time.Now()
+	assert.Nil(db.Close())
+	select {
+	case err := <-errc:
+		assert.NotNil(err)
+	case <-time.After(5 * time.Second):
+		assert.Fail("dial not aborted")
+	}
+	assert.True(time.Since(start) < 5*time.Second)
+}
+
+func TestKeepAlive(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	server := startFakeServer(assert, func(asking bool, args []string) string {
+		if args[0] == "ping" {
+			return "+PONG\r\n"
+		}
+		return "+OK\r\n"
+	})
+	defer server.Close()
+
+	for _, period := range []time.Duration{time.Minute, 0} {
+		db, err := redis.Open(redis.TCPConnection(addressOf(server), testTimeout), redis.KeepAlive(period))
+		assert.Nil(err)
+		assert.Equal(db.Options().KeepAlive, period)
+		conn, err := db.Connection()
+		assert.Nil(err)
+		result, err := conn.Do("ping")
+		assert.Nil(err)
+		assertEqualString(assert, result, 0, "+PONG")
+		conn.Return()
+		db.Close()
+	}
+
+	_, err := redis.Open(redis.KeepAlive(-time.Second))
+	assert.ErrorMatch(err, ".*invalid configuration value in field 'keep alive'.*")
+}
+
+func TestReadTimeout(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	// Server accepting connections but never answering.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(err)
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+
+	db, err := redis.Open(
+		redis.TCPConnection(ln.Addr().String(), testTimeout),
+		redis.ReadTimeout(100*time.Millisecond),
+		redis.WriteTimeout(100*time.Millisecond),
+	)
+	assert.Nil(err)
+	defer db.Close()
+	options := db.Options()
+	assert.Equal(options.ReadTimeout, 100*time.Millisecond)
+	assert.Equal(options.WriteTimeout, 100*time.Millisecond)
+
+	start := time.Now()
+	_, err = db.Connection()
+	assert.ErrorMatch(err, ".*cannot select database.*")
+	assert.True(time.Since(start) < time.Second)
+
+	_, err = redis.Open(redis.ReadTimeout(-time.Second))
+	assert.ErrorMatch(err, ".*invalid configuration value in field 'read timeout'.*")
+}
+
+func TestTransactionExecTimeout(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	// The server aborts the first EXEC with a null array and
+	// lets it run into the read timeout when hanging.
+	var mu sync.Mutex
+	execs := 0
+	hanging := false
+	server := startFakeServer(assert, func(asking bool, args []string) string {
+		switch args[0] {
+		case "set":
+			return "+QUEUED\r\n"
+		case "exec":
+			mu.Lock()
+			execs++
+			aborted := execs == 1
+			hang := hanging
+			mu.Unlock()
+			if hang {
+				time.Sleep(500 * time.Millisecond)
+				return "*1\r\n+OK\r\n"
+			}
+			if aborted {
+				return "*-1\r\n"
+			}
+			return "*1\r\n+OK\r\n"
+		}
+		return "+OK\r\n"
+	})
+	defer server.Close()
+	db, err := redis.Open(
+		redis.TCPConnection(addressOf(server), testTimeout),
+		redis.ReadTimeout(100*time.Millisecond),
+	)
+	assert.Nil(err)
+	defer db.Close()
+
+	attempts := 0
+	fn := func(tx *redis.Transaction) error {
+		attempts++
+		return tx.Do("set", "key", "value")
+	}
+
+	// Aborted transaction is retried.
+	result, err := db.DoTransaction([]string{"key"}, fn)
+	assert.Nil(err)
+	assert.Equal(result.Len(), 1)
+	assert.Equal(attempts, 2)
+
+	// I/O timeout is returned and not retried.
+	mu.Lock()
+	hanging = true
+	mu.Unlock()
+	attempts = 0
+	_, err = db.DoTransaction([]string{"key"}, fn)
+	assert.ErrorMatch(err, ".*cannot receive after exec.*i/o timeout.*")
+	assert.Equal(attempts, 1)
+}
+
+func TestClusterRedirection(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	// Node B owns the key "123456789" (slot 12739), node A
+	// still believes to own all slots.
+	var mu sync.Mutex
+	requestsA := 0
+	nodeB := startFakeServer(assert, func(asking bool, args []string) string {
+		switch strings.ToLower(args[0]) {
+		case "select":
+			return "+OK\r\n"
+		case "get":
+			return "$5\r\nvalue\r\n"
+		case "set":
+			if !asking {
+				return "-ERR missing ASKING\r\n"
+			}
+			return "+OK\r\n"
+		}
+		return "-ERR unknown command\r\n"
+	})
+	defer nodeB.Close()
+	var nodeA net.Listener
+	mu.Lock()
+	nodeA = startFakeServer(assert, func(asking bool, args []string) string {
+		mu.Lock()
+		defer mu.Unlock()
+		requestsA++
+		switch strings.ToLower(args[0]) {
+		case "select":
+			return "+OK\r\n"
+		case "cluster":
+			host, port, _ := net.SplitHostPort(addressOf(nodeA))
+			return fmt.Sprintf("*1\r\n*3\r\n:0\r\n:16383\r\n*2\r\n$%d\r\n%s\r\n:%s\r\n", len(host), host, port)
+		case "get":
+			return "-MOVED 12739 " + addressOf(nodeB) + "\r\n"
+		case "set":
+			return "-ASK 12739 " + addressOf(nodeB) + "\r\n"
+		}
+		return "-ERR unknown command\r\n"
+	})
+	mu.Unlock()
+	defer nodeA.Close()
+
+	cluster, err := redis.OpenCluster(redis.TCPConnection(addressOf(nodeA), testTimeout))
+	assert.Nil(err)
+	defer cluster.Close()
+
+	// MOVED updates the slot, so second get goes to B directly.
+	value, err := cluster.DoValue("get", "123456789")
+	assert.Nil(err)
+	assert.Equal(value.String(), "value")
+	mu.Lock()
+	before := requestsA
+	mu.Unlock()
+	value, err = cluster.DoValue("get", "{123456789}.other")
+	assert.Nil(err)
+	assert.Equal(value.String(), "value")
+	mu.Lock()
+	assert.Equal(requestsA, before)
+	mu.Unlock()
+	assert.Length(cluster.Nodes(), 2)
+
+	// ASK sends ASKING first, a key in another slot still goes to A.
+	value, err = cluster.DoValue("set", "foo", "bar")
+	assert.Nil(err)
+	assert.True(value.IsOK())
+
+	_, err = redis.OpenCluster(redis.UnixConnection("", 0))
+	assert.ErrorMatch(err, ".*cluster needs TCP connection.*")
+}
+
+func TestArgumentEncoding(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	// The server echoes the received arguments.
+	server := startFakeServer(assert, func(asking bool, args []string) string {
+		if args[0] == "select" {
+			return "+OK\r\n"
+		}
+		echo := strings.Join(args[1:], " ")
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(echo), echo)
+	})
+	defer server.Close()
+
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{-42, "-42"},
+		{int64(-9223372036854775808), "-9223372036854775808"},
+		{uint64(18446744073709551615), "18446744073709551615"},
+		{0.1, "0.1"},
+		{1.0000000000000002, "1.0000000000000002"},
+		{1e21, "1e+21"},
+		{math.Inf(1), "+Inf"},
+		{true, "true"},
+		{false, "false"},
+		{10 * time.Second, "10"},
+		{1500 * time.Millisecond, "1"},
+		{redis.PDuration(1500 * time.Millisecond), "1500"},
+		{time.Unix(1577836800, 999), "1577836800"},
+	}
+	db, err := redis.Open(redis.TCPConnection(addressOf(server), testTimeout))
+	assert.Nil(err)
+	defer db.Close()
+	conn, err := db.Connection()
+	assert.Nil(err)
+	for _, test := range tests {
+		echo, err := conn.DoString("echo", test.value)
+		assert.Nil(err)
+		assert.Equal(echo, test.expected)
+	}
+	conn.Return()
+
+	// Bools as numbers.
+	db, err = redis.Open(redis.TCPConnection(addressOf(server), testTimeout), redis.NumericBools())
+	assert.Nil(err)
+	defer db.Close()
+	assert.True(db.Options().NumericBools)
+	conn, err = db.Connection()
+	assert.Nil(err)
+	defer conn.Return()
+	echo, err := conn.DoString("echo", true, false)
+	assert.Nil(err)
+	assert.Equal(echo, "1 0")
+}
+
+func TestMapArguments(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	// The server returns the received arguments as array.
+	server := startFakeServer(assert, func(asking bool, args []string) string {
+		if args[0] == "select" {
+			return "+OK\r\n"
+		}
+		reply := fmt.Sprintf("*%d\r\n", len(args)-1)
+		for _, arg := range args[1:] {
+			reply += fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg)
+		}
+		return reply
+	})
+	defer server.Close()
+	db, err := redis.Open(redis.TCPConnection(addressOf(server), testTimeout))
+	assert.Nil(err)
+	defer db.Close()
+	conn, err := db.Connection()
+	assert.Nil(err)
+	defer conn.Return()
+
+	pairs := func(args []string) map[string]string {
+		m := map[string]string{}
+		for i := 0; i+1 < len(args); i += 2 {
+			m[args[i]] = args[i+1]
+		}
+		return m
+	}
+
+	args, err := conn.DoStrings("hset", "key", map[string]string{"a": "foo", "b": "bar baz"})
+	assert.Nil(err)
+	assert.Length(args, 5)
+	assert.Equal(args[0], "key")
+	assert.Equal(pairs(args[1:]), map[string]string{"a": "foo", "b": "bar baz"})
+
+	args, err = conn.DoStrings("hset", "key", map[string]interface{}{"a": 1, "b": 2.5, "c": true}, "d", "x")
+	assert.Nil(err)
+	assert.Length(args, 9)
+	assert.Equal(pairs(args[1:]), map[string]string{"a": "1", "b": "2.5", "c": "true", "d": "x"})
+
+	args, err = conn.DoStrings("hset", "key", map[string]string{})
+	assert.Nil(err)
+	assert.Equal(args, []string{"key"})
+}
+
+func TestDurationValues(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	// The server answers TTL in seconds and PTTL in milliseconds.
+	server := startFakeServer(assert, func(asking bool, args []string) string {
+		switch args[0] {
+		case "ttl":
+			return ":90\r\n"
+		case "pttl":
+			if args[1] == "missing" {
+				return ":-2\r\n"
+			}
+			return ":1500\r\n"
+		}
+		return "+OK\r\n"
+	})
+	defer server.Close()
+	db, err := redis.Open(redis.TCPConnection(addressOf(server), testTimeout))
+	assert.Nil(err)
+	defer db.Close()
+	conn, err := db.Connection()
+	assert.Nil(err)
+	defer conn.Return()
+
+	value, err := conn.DoValue("ttl", "key")
+	assert.Nil(err)
+	d, err := value.Duration()
+	assert.Nil(err)
+	assert.Equal(d, 90*time.Second)
+
+	value, err = conn.DoValue("pttl", "key")
+	assert.Nil(err)
+	d, err = value.PDuration()
+	assert.Nil(err)
+	assert.Equal(d, 1500*time.Millisecond)
+
+	value, err = conn.DoValue("pttl", "missing")
+	assert.Nil(err)
+	d, err = value.PDuration()
+	assert.Nil(err)
+	assert.Equal(d, -2*time.Millisecond)
+}
+
+func TestInfo(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	fixture := strings.Join([]string{
+		"# Server",
+		"redis_version:6.0.9",
+		"redis_mode:standalone",
+		"executable:/usr/local/bin/redis-server",
+		"config_file:",
+		"",
+		"# Clients",
+		"connected_clients:2",
+		"",
+		"# Memory",
+		"used_memory:873216",
+		"used_memory_human:852.75K",
+		"mem_fragmentation_ratio:7.48",
+		"",
+		"# Keyspace",
+		"db0:keys=12,expires=1,avg_ttl=3488",
+		"",
+	}, "\r\n")
+	server := startFakeServer(assert, func(asking bool, args []string) string {
+		switch args[0] {
+		case "select":
+			return "+OK\r\n"
+		case "info":
+			if len(args) == 2 && args[1] == "memory" {
+				memory := "# Memory\r\nused_memory:873216\r\n"
+				return fmt.Sprintf("$%d\r\n%s\r\n", len(memory), memory)
+			}
+			return fmt.Sprintf("$%d\r\n%s\r\n", len(fixture), fixture)
+		}
+		return "-ERR unknown command\r\n"
+	})
+	defer server.Close()
+	db, err := redis.Open(redis.TCPConnection(addressOf(server), testTimeout))
+	assert.Nil(err)
+	defer db.Close()
+	conn, err := db.Connection()
+	assert.Nil(err)
+	defer conn.Return()
+
+	info, err := conn.Info("")
+	assert.Nil(err)
+	assert.Length(info, 4)
+	assert.Equal(info["server"]["redis_version"], "6.0.9")
+	assert.Equal(info["server"]["executable"], "/usr/local/bin/redis-server")
+	value, ok := info["server"]["config_file"]
+	assert.True(ok)
+	assert.Equal(value, "")
+	assert.Equal(info["clients"]["connected_clients"], "2")
+	assert.Equal(info["memory"]["used_memory_human"], "852.75K")
+	assert.Equal(info["memory"]["mem_fragmentation_ratio"], "7.48")
+	assert.Equal(info["keyspace"]["db0"], "keys=12,expires=1,avg_ttl=3488")
+
+	info, err = conn.Info("memory")
+	assert.Nil(err)
+	assert.Length(info, 1)
+	assert.Equal(info["memory"]["used_memory"], "873216")
+}
+
+func TestTestOnBorrow(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	db, err := redis.Open(redis.TCPConnection("", testTimeout), redis.PoolSize(2), redis.TestOnBorrow())
+	assert.Nil(err)
+	defer db.Close()
+	assert.True(db.Options().TestOnBorrow)
+	killer, restore := connectDatabase(t, assert)
+	defer restore()
+
+	conn, err := db.Connection()
+	assert.Nil(err)
+	id, err := conn.DoInt("client", "id")
+	assert.Nil(err)
+	assert.Nil(conn.Return())
+
+	// Kill the pooled connection at server side.
+	killed, err := killer.DoInt("client", "kill", "id", id)
+	assert.Nil(err)
+	assert.Equal(killed, 1)
+
+	conn, err = db.Connection()
+	assert.Nil(err)
+	defer conn.Return()
+	result, err := conn.Do("ping")
+	assert.Nil(err)
+	assertEqualString(assert, result, 0, "+PONG")
+	newID, err := conn.DoInt("client", "id")
+	assert.Nil(err)
+	assert.True(newID != id)
+}
+
+func TestIdleTimeout(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	db, err := redis.Open(redis.TCPConnection("", testTimeout), redis.IdleTimeout(100*time.Millisecond))
+	assert.Nil(err)
+	defer db.Close()
+	assert.Equal(db.Options().IdleTimeout, 100*time.Millisecond)
+
+	conn, err := db.Connection()
+	assert.Nil(err)
+	id, err := conn.DoInt("client", "id")
+	assert.Nil(err)
+	assert.Nil(conn.Return())
+
+	// Idle connection is closed, so a new one is opened.
+	time.Sleep(300 * time.Millisecond)
+	conn, err = db.Connection()
+	assert.Nil(err)
+	defer conn.Return()
+	newID, err := conn.DoInt("client", "id")
+	assert.Nil(err)
+	assert.True(newID != id)
+
+	_, err = redis.Open(redis.IdleTimeout(-time.Second))
+	assert.ErrorMatch(err, ".*invalid configuration value in field 'idle timeout'.*")
+}
+
+func TestMinIdle(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	db, err := redis.Open(redis.TCPConnection("", testTimeout), redis.PoolSize(5), redis.MinIdle(3))
+	assert.Nil(err)
+	defer db.Close()
+	assert.Equal(db.Options().MinIdle, 3)
+
+	// Pool is warmed up in the background.
+	start := time.Now()
+	for db.Stats().Available < 3 && time.Since(start) < 5*time.Second {
+		time.Sleep(10 * time.Millisecond)
+	}
+	stats := db.Stats()
+	assert.Equal(stats.Available, 3)
+	assert.Equal(stats.Created, 3)
+
+	conn, err := db.Connection()
+	assert.Nil(err)
+	defer conn.Return()
+	result, err := conn.Do("ping")
+	assert.Nil(err)
+	assertEqualString(assert, result, 0, "+PONG")
+	assert.Equal(db.Stats().Created, 3)
+
+	_, err = redis.Open(redis.MinIdle(-1))
+	assert.ErrorMatch(err, ".*invalid configuration value in field 'min idle'.*")
+}
+
+func TestMaxConnLifetime(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	db, err := redis.Open(redis.TCPConnection("", testTimeout), redis.MaxConnLifetime(100*time.Millisecond))
+	assert.Nil(err)
+	defer db.Close()
+	assert.Equal(db.Options().MaxLifetime, 100*time.Millisecond)
+
+	// Young connection is reused.
+	conn, err := db.Connection()
+	assert.Nil(err)
+	id, err := conn.DoInt("client", "id")
+	assert.Nil(err)
+	assert.Nil(conn.Return())
+	conn, err = db.Connection()
+	assert.Nil(err)
+	reusedID, err := conn.DoInt("client", "id")
+	assert.Nil(err)
+	assert.Equal(reusedID, id)
+
+	// Old connection is closed when returned.
+	time.Sleep(200 * time.Millisecond)
+	assert.Nil(conn.Return())
+	conn, err = db.Connection()
+	assert.Nil(err)
+	defer conn.Return()
+	newID, err := conn.DoInt("client", "id")
+	assert.Nil(err)
+	assert.True(newID != id)
+}
+
+func TestPoolStats(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	db, err := redis.Open(redis.TCPConnection("", testTimeout), redis.PoolSize(2))
+	assert.Nil(err)
+	defer db.Close()
+	assert.Equal(db.Stats(), redis.PoolStats{})
+
+	connA, err := db.Connection()
+	assert.Nil(err)
+	connB, err := db.Connection()
+	assert.Nil(err)
+	stats := db.Stats()
+	assert.Equal(stats.InUse, 2)
+	assert.Equal(stats.Available, 0)
+	assert.Equal(stats.Created, 2)
+
+	// Exhausted pool lets the next one wait.
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		connA.Return()
+	}()
+	connC, err := db.Connection()
+	assert.Nil(err)
+	stats = db.Stats()
+	assert.Equal(stats.InUse, 2)
+	assert.Equal(stats.Created, 2)
+	assert.Equal(stats.Waits, 1)
+	assert.Equal(stats.Timeouts, 0)
+
+	assert.Nil(connB.Return())
+	assert.Nil(connC.Return())
+	stats = db.Stats()
+	assert.Equal(stats.InUse, 0)
+	assert.Equal(stats.Available, 2)
+	assert.Equal(stats.Created, 2)
+}
+
+func TestWaitTimeout(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	// Fail immediately.
+	db, err := redis.Open(redis.TCPConnection("", testTimeout), redis.PoolSize(1), redis.WaitTimeout(0))
+	assert.Nil(err)
+	defer db.Close()
+	assert.Equal(db.Options().WaitTimeout, time.Duration(0))
+	conn, err := db.Connection()
+	assert.Nil(err)
+	start := time.Now()
+	_, err = db.Connection()
+	assert.ErrorMatch(err, ".*connection pool limit.*")
+	assert.True(time.Since(start) < 50*time.Millisecond)
+	assert.Equal(db.Stats().Timeouts, 1)
+	assert.Nil(conn.Return())
+
+	// Wait longer than the default.
+	db, err = redis.Open(redis.TCPConnection("", testTimeout), redis.PoolSize(1), redis.WaitTimeout(10*time.Second))
+	assert.Nil(err)
+	defer db.Close()
+	conn, err = db.Connection()
+	assert.Nil(err)
+	go func() {
+		time.Sleep(6 * time.Second)
+		conn.Return()
+	}()
+	waitingConn, err := db.Connection()
+	assert.Nil(err)
+	assert.Nil(waitingConn.Return())
+	assert.Equal(db.Stats().Waits, 1)
+
+	_, err = redis.Open(redis.WaitTimeout(-1))
+	assert.ErrorMatch(err, ".*invalid configuration value in field 'wait timeout'.*")
+}
+
+func TestRetryBrokenConn(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	db, err := redis.Open(redis.TCPConnection("", testTimeout), redis.RetryBrokenConn(1, "SET"))
+	assert.Nil(err)
+	defer db.Close()
+	assert.Equal(db.Options().Retries, 1)
+	killer, restore := connectDatabase(t, assert)
+	defer restore()
+
+	conn, err := db.Connection()
+	assert.Nil(err)
+	defer conn.Return()
+	killConn := func() {
+		id, err := conn.DoInt("client", "id")
+		assert.Nil(err)
+		killed, err := killer.DoInt("client", "kill", "id", id)
+		assert.Nil(err)
+		assert.Equal(killed, 1)
+	}
+
+	// Reading command is retried.
+	_, err = conn.Do("set", "retry:a", "foo")
+	assert.Nil(err)
+	killConn()
+	value, err := conn.DoValue("get", "retry:a")
+	assert.Nil(err)
+	assert.Equal(value.String(), "foo")
+
+	// Explicitly allowed writing command is retried.
+	killConn()
+	ok, err := conn.DoOK("set", "retry:a", "bar")
+	assert.Nil(err)
+	assert.True(ok)
+
+	// Other writing commands are not.
+	killConn()
+	_, err = conn.Do("incr", "retry:b")
+	assert.ErrorMatch(err, ".*connection is broken.*")
+}
+
+func TestNoRetryWhileWatching(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	// The server lets the first GET after each WATCH or PING
+	// run into the read timeout.
+	var mu sync.Mutex
+	hang := false
+	server := startFakeServer(assert, func(asking bool, args []string) string {
+		mu.Lock()
+		defer mu.Unlock()
+		switch args[0] {
+		case "watch", "ping":
+			hang = true
+		case "get":
+			if hang {
+				hang = false
+				return ""
+			}
+			return "$3\r\nfoo\r\n"
+		}
+		return "+OK\r\n"
+	})
+	defer server.Close()
+	db, err := redis.Open(
+		redis.TCPConnection(addressOf(server), testTimeout),
+		redis.ReadTimeout(100*time.Millisecond),
+		redis.RetryBrokenConn(1),
+	)
+	assert.Nil(err)
+	defer db.Close()
+	conn, err := db.Connection()
+	assert.Nil(err)
+	defer conn.Return()
+
+	// Broken connection is retried without watched keys.
+	_, err = conn.Do("ping")
+	assert.Nil(err)
+	value, err := conn.DoValue("get", "key")
+	assert.Nil(err)
+	assert.Equal(value.String(), "foo")
+
+	// Broken connection while watching returns the error.
+	err = conn.Watch("key")
+	assert.Nil(err)
+	_, err = conn.DoValue("get", "key")
+	assert.ErrorMatch(err, ".*connection is broken.*")
+}
+
+func TestNoRetryWithContext(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+	// The server lets the first GET run into the read timeout.
+	var mu sync.Mutex
+	gets := 0
+	server := startFakeServer(assert, func(asking bool, args []string) string {
+		mu.Lock()
+		defer mu.Unlock()
+		if args[0] == "get" {
+			if gets++; gets == 1 {
+				return ""
+			}
+			return "$3\r\nfoo\r\n"
+		}
+		return "+OK\r\n"
+	})
+	defer server.Close()
+	db, err := redis.Open(
+		redis.TCPConnection(addressOf(server), testTimeout),
+		redis.ReadTimeout(100*time.Millisecond),
+		redis.RetryBrokenConn(1),
+	)
+	assert.Nil(err)
+	defer db.Close()
+	conn, err := db.Connection()
+	assert.Nil(err)
+
+	// Cancelable context without deadline is not retried.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err = conn.DoContext(ctx, "get", "key")
+	assert.ErrorMatch(err, ".*connection is broken.*")
+	assert.Nil(conn.Return())
+	assert.Equal(db.Stats().InUse, 0)
+	mu.Lock()
+	assert.Equal(gets, 1)
+	mu.Unlock()
+}
+
 func TestConcurrency(t *testing.T) {
 	assert := asserts.NewTesting(t, asserts.FailStop)
 	db, err := redis.Open(redis.TCPConnection("", 0), redis.PoolSize(100))
@@ -214,6 +1207,68 @@ func subscribeDatabase(t *testing.T, assert *asserts.Asserts, options ...redis.O
 	}
 }
 
+// fakeHandler answers the passed command of a fake server with a
+// raw RESP response. Asking signals a preceding ASKING command.
+type fakeHandler func(asking bool, args []string) string
+
+// startFakeServer starts a server speaking enough RESP for testing
+// the client without a real Redis, e.g. the cluster redirections.
+func startFakeServer(assert *asserts.Asserts, handle fakeHandler) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(err)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveFakeConnection(c, handle)
+		}
+	}()
+	return ln
+}
+
+// serveFakeConnection reads the commands of one connection and
+// writes the responses of the handler.
+func serveFakeConnection(c net.Conn, handle fakeHandler) {
+	defer c.Close()
+	reader := bufio.NewReader(c)
+	asking := false
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		count, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return
+		}
+		args := make([]string, count)
+		for i := range args {
+			if _, err := reader.ReadString('\n'); err != nil {
+				return
+			}
+			arg, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			args[i] = strings.TrimSuffix(arg, "\r\n")
+		}
+		if strings.ToLower(args[0]) == "asking" {
+			asking = true
+			c.Write([]byte("+OK\r\n"))
+			continue
+		}
+		c.Write([]byte(handle(asking, args)))
+		asking = false
+	}
+}
+
+// addressOf returns the address of a fake server.
+func addressOf(ln net.Listener) string {
+	return ln.Addr().String()
+}
+
 // assertEqualString checks if the result at index is value.
 func assertEqualString(assert *asserts.Asserts, result *redis.ResultSet, index int, value string) {
 	s, err := result.StringAt(index)
@@ -17,6 +17,9 @@ import (
 	"io"
 	"net"
 	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"tideland.dev/go/trace/failure"
 )
@@ -75,10 +78,19 @@ func (r *response) String() string {
 
 // resp implements the Redis Serialization Protocol.
 type resp struct {
-	database *Database
-	conn     net.Conn
-	reader   *bufio.Reader
-	cmd      string
+	database     *Database
+	conn         net.Conn
+	reader       *bufio.Reader
+	mu           sync.Mutex
+	cmd          string
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	deadline     time.Time
+	aborted      int32
+	created      time.Time
+	lastUsed     time.Time
+	named        bool
+	index        int
 }
 
 // newResp establishes a connection to a Redis database
@@ -86,29 +98,66 @@ type resp struct {
 // configuration.
 func newResp(db *Database) (*resp, error) {
 	// Dial the database and create the protocol instance.
-	conn, err := net.DialTimeout(db.network, db.address, db.timeout)
+	dialer := &net.Dialer{
+		Timeout: db.timeout,
+		// Keep-alive is set explicitly below.
+		KeepAlive: -1,
+	}
+	conn, err := dialer.DialContext(db.ctx, db.network, db.address)
 	if err != nil {
 		return nil, failure.Annotate(err, "cannot establish new connection")
 	}
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		if err = setKeepAlive(tcpConn, db.keepAlive); err != nil {
+			conn.Close()
+			return nil, failure.Annotate(err, "cannot set keep-alive")
+		}
+	}
 	r := &resp{
-		database: db,
-		conn:     conn,
-		reader:   bufio.NewReader(conn),
+		database:     db,
+		conn:         conn,
+		reader:       bufio.NewReader(conn),
+		readTimeout:  db.readTimeout,
+		writeTimeout: db.writeTimeout,
+		created:      time.Now(),
 	}
 	return r, nil
 }
 
+// keepAliver describes connections allowing to control
+// the TCP keep-alive like *net.TCPConn.
+type keepAliver interface {
+	SetKeepAlive(keepalive bool) error
+	SetKeepAlivePeriod(period time.Duration) error
+}
+
+// setKeepAlive enables the TCP keep-alive with the given
+// period or disables it if the period is 0.
+func setKeepAlive(conn keepAliver, period time.Duration) error {
+	if period == 0 {
+		return conn.SetKeepAlive(false)
+	}
+	if err := conn.SetKeepAlive(true); err != nil {
+		return err
+	}
+	return conn.SetKeepAlivePeriod(period)
+}
+
 // sendCommand sends a command and possible arguments to the server.
 func (r *resp) sendCommand(cmd string, args ...interface{}) error {
-	r.cmd = cmd
+	r.setCommand(cmd)
 	lengthPart := r.buildLengthPart(args)
 	cmdPart := r.buildValuePart(cmd)
 	argsPart := r.buildArgumentsPart(args)
 
 	packet := join(lengthPart, cmdPart, argsPart)
-	_, err := r.conn.Write(packet)
+	err := r.applyDeadline(r.conn.SetWriteDeadline, r.writeTimeout)
+	if err != nil {
+		return failure.Annotate(err, "cannot send %s, connection is broken", cmd)
+	}
+	_, err = r.conn.Write(packet)
 	if err != nil {
-		return failure.Annotate(err, "cannot send %s, connection is broken", r.cmd)
+		return failure.Annotate(err, "cannot send %s, connection is broken", cmd)
 	}
 	return nil
 }
@@ -116,9 +165,14 @@ func (r *resp) sendCommand(cmd string, args ...interface{}) error {
 // receiveResponse retrieves a response from the server.
 func (r *resp) receiveResponse() *response {
 	// Receive first line.
+	err := r.applyDeadline(r.conn.SetReadDeadline, r.readTimeout)
+	if err != nil {
+		rerr := failure.Annotate(err, "cannot receive after %s, connection is broken", r.command())
+		return &response{receivingError, 0, nil, rerr}
+	}
 	line, err := r.reader.ReadBytes('\n')
 	if err != nil {
-		rerr := failure.Annotate(err, "cannot receive after %s, connection is broken", r.cmd)
+		rerr := failure.Annotate(err, "cannot receive after %s, connection is broken", r.command())
 		return &response{receivingError, 0, nil, rerr}
 	}
 	content := line[1 : len(line)-2]
@@ -171,11 +225,14 @@ func (r *resp) receiveResponse() *response {
 
 // receiveResultSet receives all responses and converts them into a result set.
 func (r *resp) receiveResultSet() (*ResultSet, error) {
-	defer func() { r.cmd = "-none-" }()
+	defer r.setCommand("-none-")
 	result := newResultSet()
 	current := result
+	first := true
 	for {
 		response := r.receiveResponse()
+		isFirst := first
+		first = false
 		switch response.kind {
 		case receivingError:
 			return nil, response.err
@@ -185,7 +242,7 @@ func (r *resp) receiveResultSet() (*ResultSet, error) {
 			current.append(response.value())
 		case arrayResponse:
 			switch {
-			case current == result && current.Len() == 0:
+			case isFirst:
 				current.length = response.length
 			case !current.allReceived():
 				next := newResultSet()
@@ -203,6 +260,31 @@ func (r *resp) receiveResultSet() (*ResultSet, error) {
 	}
 }
 
+// receiveStream receives all responses and passes the values to the
+// function. After an error of the function the rest is only read.
+func (r *resp) receiveStream(fn func(Value) error) error {
+	defer r.setCommand("-none-")
+	var fnErr error
+	pending := 1
+	for pending > 0 {
+		response := r.receiveResponse()
+		pending--
+		switch response.kind {
+		case receivingError:
+			return response.err
+		case timeoutError:
+			// Null array, nothing to pass.
+		case arrayResponse:
+			pending += response.length
+		default:
+			if fnErr == nil {
+				fnErr = fn(response.value())
+			}
+		}
+	}
+	return fnErr
+}
+
 // buildLengthPart creates the length part of a command.
 func (r *resp) buildLengthPart(args []interface{}) []byte {
 	length := 1
@@ -210,10 +292,16 @@ func (r *resp) buildLengthPart(args []interface{}) []byte {
 		switch typedArg := arg.(type) {
 		case valuer:
 			length += typedArg.Len()
+		case []string:
+			length += len(typedArg)
 		case Hash:
 			length += typedArg.Len() * 2
 		case Hashable:
 			length += typedArg.Len() * 2
+		case map[string]string:
+			length += len(typedArg) * 2
+		case map[string]interface{}:
+			length += len(typedArg) * 2
 		default:
 			length++
 		}
@@ -224,9 +312,19 @@ func (r *resp) buildLengthPart(args []interface{}) []byte {
 // buildValuePart creates one value part of a command.
 func (r *resp) buildValuePart(value interface{}) []byte {
 	var raw []byte
-	if v, ok := value.(Value); ok {
+	switch v := value.(type) {
+	case Value:
 		raw = []byte(v)
-	} else {
+	case bool:
+		switch {
+		case !r.database.numericBools:
+			raw = valueToBytes(v)
+		case v:
+			raw = []byte("1")
+		default:
+			raw = []byte("0")
+		}
+	default:
 		raw = valueToBytes(value)
 	}
 	return join("$", len(raw), "\r\n", raw, "\r\n")
@@ -255,10 +353,24 @@ func (r *resp) buildArgumentsPart(args []interface{}) []byte {
 		switch typedArg := arg.(type) {
 		case valuer:
 			part = buildValuesPart(typedArg)
+		case []string:
+			for _, s := range typedArg {
+				part = append(part, r.buildValuePart(s)...)
+			}
 		case Hash:
 			part = buildHashPart(typedArg)
 		case Hashable:
 			part = buildHashPart(typedArg.GetHash())
+		case map[string]string:
+			for key, value := range typedArg {
+				part = append(part, r.buildValuePart(key)...)
+				part = append(part, r.buildValuePart(value)...)
+			}
+		case map[string]interface{}:
+			for key, value := range typedArg {
+				part = append(part, r.buildValuePart(key)...)
+				part = append(part, r.buildValuePart(value)...)
+			}
 		default:
 			part = r.buildValuePart(arg)
 		}
@@ -267,10 +379,57 @@ func (r *resp) buildArgumentsPart(args []interface{}) []byte {
 	return tmp
 }
 
+// setCommand stores the current command for error messages. It
+// may be sent while another goroutine receives, e.g. in subscriptions.
+func (r *resp) setCommand(cmd string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cmd = cmd
+}
+
+// command returns the current command.
+func (r *resp) command() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cmd
+}
+
+// applyDeadline sets the deadline for the next read or write
+// operation based on the passed timeout and a possible deadline
+// of a context. A zero time means no deadline. The abort flag is
+// checked afterwards so that a concurrent abort always wins.
+func (r *resp) applyDeadline(set func(time.Time) error, timeout time.Duration) error {
+	deadline := r.deadline
+	if timeout > 0 {
+		next := time.Now().Add(timeout)
+		if deadline.IsZero() || next.Before(deadline) {
+			deadline = next
+		}
+	}
+	if err := set(deadline); err != nil {
+		return err
+	}
+	if atomic.LoadInt32(&r.aborted) == 1 {
+		return set(time.Now())
+	}
+	return nil
+}
+
+// abort lets the current and all following operations fail
+// immediately. The protocol cannot be used anymore afterwards.
+func (r *resp) abort() {
+	atomic.StoreInt32(&r.aborted, 1)
+	r.conn.SetDeadline(time.Now())
+}
+
 // authenticate authenticates against the server if configured.
 func (r *resp) authenticate() error {
 	if r.database.password != "" {
-		err := r.sendCommand("auth", r.database.password)
+		args := []interface{}{r.database.password}
+		if r.database.username != "" {
+			args = []interface{}{r.database.username, r.database.password}
+		}
+		err := r.sendCommand("auth", args...)
 		if err != nil {
 			return failure.Annotate(err, "cannot authenticate")
 		}
@@ -289,9 +448,39 @@ func (r *resp) authenticate() error {
 	return nil
 }
 
-// selectDatabase selects the database.
+// setClientName sets the configured client name once
+// for the connection.
+func (r *resp) setClientName() error {
+	if r.database.clientName == "" || r.named {
+		return nil
+	}
+	err := r.sendCommand("client", "setname", r.database.clientName)
+	if err != nil {
+		return failure.Annotate(err, "cannot set client name")
+	}
+	result, err := r.receiveResultSet()
+	if err != nil {
+		return failure.Annotate(err, "cannot set client name")
+	}
+	value, err := result.ValueAt(0)
+	if err != nil {
+		return failure.Annotate(err, "cannot set client name")
+	}
+	if !value.IsOK() {
+		return failure.New("cannot set client name: %v", value)
+	}
+	r.named = true
+	return nil
+}
+
+// selectDatabase selects the configured database.
 func (r *resp) selectDatabase() error {
-	err := r.sendCommand("select", r.database.index)
+	return r.selectIndex(r.database.index)
+}
+
+// selectIndex selects the database with the given index.
+func (r *resp) selectIndex(index int) error {
+	err := r.sendCommand("select", index)
 	if err != nil {
 		return failure.Annotate(err, "cannot select database")
 	}
@@ -306,9 +495,20 @@ func (r *resp) selectDatabase() error {
 	if !value.IsOK() {
 		return failure.New("cannot select database")
 	}
+	r.index = index
 	return nil
 }
 
+// ping checks if the connection is healthy. Any answer counts,
+// as it may be an error before the authentication.
+func (r *resp) ping() bool {
+	if err := r.sendCommand("ping"); err != nil {
+		return false
+	}
+	_, err := r.receiveResultSet()
+	return err == nil
+}
+
 // close ends the connection to Redis.
 func (r *resp) close() error {
 	return r.conn.Close()
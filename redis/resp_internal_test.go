@@ -0,0 +1,66 @@
+// Tideland Go Database Clients - Redis Client - Internal Unit Tests
+//
+// Copyright (C) 2017-2020 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redis
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"tideland.dev/go/audit/asserts"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+func TestSetKeepAlive(t *testing.T) {
+	assert := asserts.NewTesting(t, asserts.FailStop)
+
+	conn := &recordingConn{}
+	err := setKeepAlive(conn, time.Minute)
+	assert.Nil(err)
+	assert.Equal(conn.calls, []string{"keep-alive true", "period 1m0s"})
+
+	conn = &recordingConn{}
+	err = setKeepAlive(conn, 0)
+	assert.Nil(err)
+	assert.Equal(conn.calls, []string{"keep-alive false"})
+
+	conn = &recordingConn{err: errors.New("failed")}
+	err = setKeepAlive(conn, time.Minute)
+	assert.ErrorMatch(err, "failed")
+	assert.Equal(conn.calls, []string{"keep-alive true"})
+}
+
+//--------------------
+// HELPERS
+//--------------------
+
+// recordingConn records the keep-alive calls.
+type recordingConn struct {
+	calls []string
+	err   error
+}
+
+func (c *recordingConn) SetKeepAlive(keepalive bool) error {
+	c.calls = append(c.calls, fmt.Sprintf("keep-alive %v", keepalive))
+	return c.err
+}
+
+func (c *recordingConn) SetKeepAlivePeriod(period time.Duration) error {
+	c.calls = append(c.calls, fmt.Sprintf("period %v", period))
+	return c.err
+}
+
+// EOF
@@ -13,6 +13,7 @@ package redis // import "tideland.dev/go/db/redis"
 
 import (
 	"fmt"
+	"math"
 	"strings"
 
 	"tideland.dev/go/trace/failure"
@@ -103,6 +104,16 @@ func (rs *ResultSet) IntAt(index int) (int, error) {
 	return value.Int()
 }
 
+// FloatAt returns the value at index as float64. This is a convenience
+// method as floats are returned e.g. for scores.
+func (rs *ResultSet) FloatAt(index int) (float64, error) {
+	value, err := rs.ValueAt(index)
+	if err != nil {
+		return 0.0, err
+	}
+	return value.Float64()
+}
+
 // StringAt returns the value at index as string. This is a convenience
 // method as the string is needed very often.
 func (rs *ResultSet) StringAt(index int) (string, error) {
@@ -209,6 +220,43 @@ func (rs *ResultSet) Hash() (Hash, error) {
 	return hash, nil
 }
 
+// StreamEntries returns the entries of a stream like returned
+// by XRANGE. Each one is an array of the ID and the fields.
+func (rs *ResultSet) StreamEntries() (StreamEntries, error) {
+	ses := StreamEntries{}
+	for index := range rs.items {
+		entry, err := rs.ResultSetAt(index)
+		if err != nil {
+			return nil, err
+		}
+		id, err := entry.StringAt(0)
+		if err != nil {
+			return nil, err
+		}
+		fields, err := entry.ResultSetAt(1)
+		if err != nil {
+			return nil, err
+		}
+		hash, err := fields.Hash()
+		if err != nil {
+			return nil, err
+		}
+		ses = append(ses, StreamEntry{id, hash})
+	}
+	return ses, nil
+}
+
+// ScanStruct sets the fields of the struct dest points to with the
+// alternating keys and values of the result set like returned by
+// HGETALL. See Hash.ScanStruct() for the mapping.
+func (rs *ResultSet) ScanStruct(dest interface{}) error {
+	hash, err := rs.Hash()
+	if err != nil {
+		return err
+	}
+	return hash.ScanStruct(dest)
+}
+
 // Scanned returns the cursor and the keys or values of a
 // scan operation.
 func (rs *ResultSet) Scanned() (int, *ResultSet, error) {
@@ -234,6 +282,44 @@ func (rs *ResultSet) Strings() []string {
 	return ss
 }
 
+// Bytes returns all values of the array as a slice of byte slices
+// without converting them. Nested arrays lead to an error.
+func (rs *ResultSet) Bytes() ([][]byte, error) {
+	bs := make([][]byte, len(rs.items))
+	for index, item := range rs.items {
+		value, ok := item.(Value)
+		if !ok {
+			return nil, failure.New("item at index %d is no %s", index, "value")
+		}
+		bs[index] = value.Bytes()
+	}
+	return bs, nil
+}
+
+// Floats returns all values of the array as float64, e.g. the
+// scores of ZMSCORE. Nil values of missing members are returned
+// as NaN, which is never a valid score. Nested arrays lead to an
+// error.
+func (rs *ResultSet) Floats() ([]float64, error) {
+	fs := make([]float64, len(rs.items))
+	for index, item := range rs.items {
+		value, ok := item.(Value)
+		if !ok {
+			return nil, failure.New("item at index %d is no %s", index, "value")
+		}
+		if value.IsNil() {
+			fs[index] = math.NaN()
+			continue
+		}
+		f, err := value.Float64()
+		if err != nil {
+			return nil, err
+		}
+		fs[index] = f
+	}
+	return fs, nil
+}
+
 // String returns the result set in a human readable form.
 func (rs *ResultSet) String() string {
 	out := "RESULT SET ("
@@ -0,0 +1,171 @@
+// Tideland Go Database Clients - Redis Client
+//
+// Copyright (C) 2017-2020 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redis // import "tideland.dev/go/db/redis"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"tideland.dev/go/trace/failure"
+)
+
+//--------------------
+// SCAN ITERATOR
+//--------------------
+
+// ScanIterator iterates over the results of SCAN, HSCAN, SSCAN, or
+// ZSCAN. It continues with the returned cursors until the scan is
+// complete. Only the current batch is held in memory.
+type ScanIterator struct {
+	conn    *Connection
+	cmd     string
+	key     string
+	width   int
+	match   string
+	count   int
+	cursor  int
+	started bool
+	values  Values
+	index   int
+	current Value
+	value   Value
+	err     error
+}
+
+// Scan returns an iterator over all keys matching the pattern. An
+// empty match means all keys, count is a hint for the batch size
+// and is ignored if 0.
+func (conn *Connection) Scan(match string, count int) *ScanIterator {
+	return newScanIterator(conn, "scan", "", 1, match, count)
+}
+
+// ScanAll runs SCAN to completion and returns all distinct keys
+// matching the pattern. Match and count work like for Scan. A limit
+// greater than 0 caps the number of keys, exceeding it returns an
+// error instead of growing without bounds.
+func (conn *Connection) ScanAll(match string, count, limit int) ([]string, error) {
+	keys := []string{}
+	seen := map[string]struct{}{}
+	it := conn.Scan(match, count)
+	for it.Next() {
+		key := it.Key()
+		if _, ok := seen[key]; ok {
+			// SCAN may return keys more than once.
+			continue
+		}
+		if limit > 0 && len(keys) >= limit {
+			return nil, failure.New("scan exceeds limit of %d keys", limit)
+		}
+		seen[key] = struct{}{}
+		keys = append(keys, key)
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// HScan returns an iterator over the fields and values of the hash
+// with the given key. Match and count work like for Scan.
+func (conn *Connection) HScan(key, match string, count int) *ScanIterator {
+	return newScanIterator(conn, "hscan", key, 2, match, count)
+}
+
+// SScan returns an iterator over the members of the set with the
+// given key. Match and count work like for Scan.
+func (conn *Connection) SScan(key, match string, count int) *ScanIterator {
+	return newScanIterator(conn, "sscan", key, 1, match, count)
+}
+
+// ZScan returns an iterator over the members and scores of the sorted
+// set with the given key. Match and count work like for Scan.
+func (conn *Connection) ZScan(key, match string, count int) *ScanIterator {
+	return newScanIterator(conn, "zscan", key, 2, match, count)
+}
+
+// newScanIterator creates an iterator for the scan command. The width
+// is the number of values per iteration step.
+func newScanIterator(conn *Connection, cmd, key string, width int, match string, count int) *ScanIterator {
+	return &ScanIterator{
+		conn:  conn,
+		cmd:   cmd,
+		key:   key,
+		width: width,
+		match: match,
+		count: count,
+	}
+}
+
+// Next moves to the next key. It returns false if the scan
+// is complete or an error occurred.
+func (it *ScanIterator) Next() bool {
+	for it.err == nil {
+		if it.index+it.width <= len(it.values) {
+			it.current = it.values[it.index]
+			if it.width > 1 {
+				it.value = it.values[it.index+1]
+			}
+			it.index += it.width
+			return true
+		}
+		if it.started && it.cursor == 0 {
+			return false
+		}
+		it.fetch()
+	}
+	return false
+}
+
+// Key returns the current key, hash field, or set member.
+func (it *ScanIterator) Key() string {
+	return it.current.String()
+}
+
+// Value returns the value of the current hash field or the
+// score of the current sorted set member. It is nil for SCAN
+// and SSCAN.
+func (it *ScanIterator) Value() Value {
+	return it.value
+}
+
+// Score returns the score of the current sorted set member.
+func (it *ScanIterator) Score() (float64, error) {
+	return it.value.Float64()
+}
+
+// Err returns the error which possibly ended the iteration.
+func (it *ScanIterator) Err() error {
+	return it.err
+}
+
+// fetch retrieves the next batch of values.
+func (it *ScanIterator) fetch() {
+	args := []interface{}{}
+	if it.cmd != "scan" {
+		args = append(args, it.key)
+	}
+	args = append(args, it.cursor)
+	if it.match != "" {
+		args = append(args, "match", it.match)
+	}
+	if it.count > 0 {
+		args = append(args, "count", it.count)
+	}
+	cursor, result, err := it.conn.DoScan(it.cmd, args...)
+	if err != nil {
+		it.err = err
+		return
+	}
+	it.started = true
+	it.cursor = cursor
+	it.values = result.Values()
+	it.index = 0
+}
+
+// EOF
@@ -0,0 +1,83 @@
+// Tideland Go Database Clients - Redis Client
+//
+// Copyright (C) 2017-2020 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redis // import "tideland.dev/go/db/redis"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+)
+
+//--------------------
+// SCRIPT
+//--------------------
+
+// Script contains a Lua script to be executed by Redis. It is
+// referenced by its SHA1 digest to avoid sending the source
+// with each execution.
+type Script struct {
+	src string
+	sha string
+}
+
+// NewScript creates a script with the given Lua source.
+func NewScript(src string) *Script {
+	digest := sha1.Sum([]byte(src))
+	return &Script{
+		src: src,
+		sha: hex.EncodeToString(digest[:]),
+	}
+}
+
+// SHA returns the SHA1 digest identifying the script.
+func (s *Script) SHA() string {
+	return s.sha
+}
+
+// Run executes the script with the keys and arguments on the passed
+// connection. It uses EVALSHA and only sends the source with EVAL if
+// the script is not yet known by the server. Afterwards the server
+// caches it.
+func (s *Script) Run(conn *Connection, keys []string, args ...interface{}) (*ResultSet, error) {
+	result, err := conn.Do("evalsha", s.arguments(s.sha, keys, args)...)
+	if err != nil {
+		return nil, err
+	}
+	if !isNoScript(result) {
+		return result, nil
+	}
+	return conn.Do("eval", s.arguments(s.src, keys, args)...)
+}
+
+// arguments builds the arguments of EVAL and EVALSHA.
+func (s *Script) arguments(script string, keys []string, args []interface{}) []interface{} {
+	all := make([]interface{}, 0, 2+len(keys)+len(args))
+	all = append(all, script, len(keys))
+	for _, key := range keys {
+		all = append(all, key)
+	}
+	return append(all, args...)
+}
+
+// isNoScript checks if the result signals an unknown script.
+func isNoScript(result *ResultSet) bool {
+	if result.Len() != 1 {
+		return false
+	}
+	value, err := result.ValueAt(0)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(value.String(), "-NOSCRIPT")
+}
+
+// EOF
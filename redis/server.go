@@ -0,0 +1,116 @@
+// Tideland Go Database Clients - Redis Client
+//
+// Copyright (C) 2017-2020 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redis // import "tideland.dev/go/db/redis"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"strings"
+	"time"
+
+	"tideland.dev/go/trace/failure"
+)
+
+//--------------------
+// SERVER
+//--------------------
+
+// Info returns the information of the server section, e.g. "memory",
+// or of the default sections if empty. The outer map is keyed by the
+// lowercase section names, the inner ones contain the fields. All
+// values are returned as strings.
+func (conn *Connection) Info(section string) (map[string]map[string]string, error) {
+	args := []interface{}{}
+	if section != "" {
+		args = append(args, section)
+	}
+	text, err := conn.DoString("info", args...)
+	if err != nil {
+		return nil, err
+	}
+	info := map[string]map[string]string{}
+	current := ""
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#"):
+			current = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(line, "#")))
+			if info[current] == nil {
+				info[current] = map[string]string{}
+			}
+		default:
+			parts := strings.SplitN(line, ":", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			if info[current] == nil {
+				info[current] = map[string]string{}
+			}
+			info[current][parts[0]] = parts[1]
+		}
+	}
+	return info, nil
+}
+
+// ConfigGet returns the configuration parameters matching the
+// pattern, e.g. "maxmemory*", with their values.
+func (conn *Connection) ConfigGet(pattern string) (map[string]string, error) {
+	result, err := conn.Do("config", "get", pattern)
+	if err != nil {
+		return nil, err
+	}
+	if result.Len()%2 != 0 {
+		value, _ := result.ValueAt(0)
+		return nil, failure.New("cannot get config %q: %v", pattern, value)
+	}
+	hash, err := result.Hash()
+	if err != nil {
+		return nil, err
+	}
+	config := make(map[string]string, hash.Len())
+	for param, value := range hash {
+		config[param] = value.String()
+	}
+	return config, nil
+}
+
+// ConfigSet sets the configuration parameter to the value.
+func (conn *Connection) ConfigSet(param, value string) error {
+	reply, err := conn.DoValue("config", "set", param, value)
+	if err != nil {
+		return err
+	}
+	if !reply.IsOK() {
+		return failure.New("cannot set config %q: %v", param, reply)
+	}
+	return nil
+}
+
+// DebugSleep blocks the server for the duration using DEBUG SLEEP,
+// e.g. for deterministic timeout tests. Take care, DEBUG is an admin
+// command blocking all clients. Since Redis 7 it has to be enabled
+// with the configuration "enable-debug-command".
+func (conn *Connection) DebugSleep(d time.Duration) error {
+	if d < 0 {
+		return failure.New("invalid sleep duration %v", d)
+	}
+	reply, err := conn.DoValue("debug", "sleep", d.Seconds())
+	if err != nil {
+		return err
+	}
+	if !reply.IsOK() {
+		return failure.New("cannot execute debug sleep: %v", reply)
+	}
+	return nil
+}
+
+// EOF
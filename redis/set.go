@@ -0,0 +1,70 @@
+// Tideland Go Database Clients - Redis Client
+//
+// Copyright (C) 2017-2020 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redis // import "tideland.dev/go/db/redis"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"tideland.dev/go/trace/failure"
+)
+
+//--------------------
+// SET CARDINALITIES
+//--------------------
+
+// SCard returns the number of members of the set with the key.
+func (conn *Connection) SCard(key string) (int, error) {
+	return conn.DoInt("scard", key)
+}
+
+// SInterCard returns the number of members of the intersection of the
+// sets without returning them. A limit larger than 0 stops counting
+// when it's reached. It needs Redis 7 or later.
+func (conn *Connection) SInterCard(limit int, keys ...string) (int, error) {
+	if len(keys) == 0 {
+		return 0, failure.New("no keys to intersect")
+	}
+	if limit < 0 {
+		return 0, failure.New("invalid limit %d", limit)
+	}
+	args := []interface{}{len(keys), keys}
+	if limit > 0 {
+		args = append(args, "limit", limit)
+	}
+	return conn.DoInt("sintercard", args...)
+}
+
+// SDiffStore stores the difference of the first set and the following
+// ones at the destination and returns its number of members.
+func (conn *Connection) SDiffStore(destination string, keys ...string) (int, error) {
+	return conn.store("sdiffstore", destination, keys)
+}
+
+// SInterStore stores the intersection of the sets at the
+// destination and returns its number of members.
+func (conn *Connection) SInterStore(destination string, keys ...string) (int, error) {
+	return conn.store("sinterstore", destination, keys)
+}
+
+// SUnionStore stores the union of the sets at the destination
+// and returns its number of members.
+func (conn *Connection) SUnionStore(destination string, keys ...string) (int, error) {
+	return conn.store("sunionstore", destination, keys)
+}
+
+// store executes one of the storing set commands.
+func (conn *Connection) store(cmd, destination string, keys []string) (int, error) {
+	if len(keys) == 0 {
+		return 0, failure.New("no keys for %s", cmd)
+	}
+	return conn.DoInt(cmd, destination, keys)
+}
+
+// EOF
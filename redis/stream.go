@@ -0,0 +1,106 @@
+// Tideland Go Database Clients - Redis Client
+//
+// Copyright (C) 2017-2020 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redis // import "tideland.dev/go/db/redis"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"time"
+
+	"tideland.dev/go/trace/failure"
+)
+
+//--------------------
+// STREAMS
+//--------------------
+
+// XAdd appends an entry with the fields to the stream with the
+// given key. An empty ID lets Redis generate it. The ID of the
+// new entry is returned.
+func (conn *Connection) XAdd(key, id string, fields Hash) (string, error) {
+	if id == "" {
+		id = "*"
+	}
+	if fields.Len() == 0 {
+		return "", failure.New("stream entry needs fields")
+	}
+	return conn.DoString("xadd", key, id, fields)
+}
+
+// XRange returns the entries of the stream with the given key
+// between the start and end IDs including them. Use "-" and "+"
+// for the first and last entry. A count of 0 returns all.
+func (conn *Connection) XRange(key, start, end string, count int) (StreamEntries, error) {
+	args := []interface{}{key, start, end}
+	if count > 0 {
+		args = append(args, "count", count)
+	}
+	result, err := conn.Do("xrange", args...)
+	if err != nil {
+		return nil, err
+	}
+	return result.StreamEntries()
+}
+
+// XRead returns the entries of the streams following the IDs
+// passed for each stream key, "$" reads only new ones. If there
+// are none it blocks up to the given duration, 0 means forever,
+// negative values don't block. A count of 0 returns all. The
+// read timeout of the database has to be longer than the blocking.
+func (conn *Connection) XRead(streams map[string]string, count int, block time.Duration) (map[string]StreamEntries, error) {
+	if len(streams) == 0 {
+		return nil, failure.New("no streams to read")
+	}
+	args := []interface{}{}
+	if count > 0 {
+		args = append(args, "count", count)
+	}
+	if block >= 0 {
+		args = append(args, "block", int64(block/time.Millisecond))
+	}
+	keys := make([]string, 0, len(streams))
+	ids := make([]string, 0, len(streams))
+	for key, id := range streams {
+		keys = append(keys, key)
+		ids = append(ids, id)
+	}
+	args = append(args, "streams", keys, ids)
+	result, err := conn.Do("xread", args...)
+	if err != nil {
+		if IsTimeout(err) {
+			// XREAD answers with a null array if nothing has been read.
+			return map[string]StreamEntries{}, nil
+		}
+		return nil, err
+	}
+	entries := make(map[string]StreamEntries)
+	for index := 0; index < result.Len(); index++ {
+		stream, err := result.ResultSetAt(index)
+		if err != nil {
+			return nil, err
+		}
+		key, err := stream.StringAt(0)
+		if err != nil {
+			return nil, err
+		}
+		streamResult, err := stream.ResultSetAt(1)
+		if err != nil {
+			return nil, err
+		}
+		ses, err := streamResult.StreamEntries()
+		if err != nil {
+			return nil, err
+		}
+		entries[key] = ses
+	}
+	return entries, nil
+}
+
+// EOF
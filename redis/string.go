@@ -0,0 +1,46 @@
+// Tideland Go Database Clients - Redis Client
+//
+// Copyright (C) 2017-2020 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redis // import "tideland.dev/go/db/redis"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"time"
+
+	"tideland.dev/go/trace/failure"
+)
+
+//--------------------
+// STRINGS
+//--------------------
+
+// GetDel returns the value of the key and deletes it atomically. The
+// value is nil if the key doesn't exist. It needs Redis 6.2 or later.
+func (conn *Connection) GetDel(key string) (Value, error) {
+	return conn.DoValue("getdel", key)
+}
+
+// GetEx returns the value of the key and sets its expiration atomically.
+// Durations with fractions of seconds are set in milliseconds, 0 removes
+// the expiration. The value is nil if the key doesn't exist. It needs
+// Redis 6.2 or later.
+func (conn *Connection) GetEx(key string, expire time.Duration) (Value, error) {
+	switch {
+	case expire < 0:
+		return nil, failure.New("invalid expiration %v", expire)
+	case expire == 0:
+		return conn.DoValue("getex", key, "persist")
+	case expire%time.Second == 0:
+		return conn.DoValue("getex", key, "ex", int64(expire/time.Second))
+	}
+	return conn.DoValue("getex", key, "px", int64(expire/time.Millisecond))
+}
+
+// EOF
@@ -12,11 +12,17 @@ package redis // import "tideland.dev/go/db/redis"
 //--------------------
 
 import (
-	"strings"
-
 	"tideland.dev/go/trace/failure"
 )
 
+//--------------------
+// CONSTANTS
+//--------------------
+
+// messageBufferSize is the buffer size of the channel
+// delivering the received messages.
+const messageBufferSize = 64
+
 //--------------------
 // SUBSCRIPTION
 //--------------------
@@ -26,6 +32,10 @@ import (
 type Subscription struct {
 	database *Database
 	resp     *resp
+	messages chan *PubSubMessage
+	stop     chan struct{}
+	done     chan struct{}
+	err      error
 }
 
 // newSubscription creates a new subscription.
@@ -43,113 +53,220 @@ func newSubscription(db *Database) (*Subscription, error) {
 		sub.database.pool.kill(sub.resp)
 		return nil, err
 	}
+	err = sub.resp.setClientName()
+	if err != nil {
+		sub.database.pool.kill(sub.resp)
+		return nil, err
+	}
 	return sub, nil
 }
 
-// Subscribe adds one or more channels to the subscription.
+// Subscribe adds one or more channels to the subscription. Channels
+// containing patterns are subscribed like with PSubscribe().
 func (sub *Subscription) Subscribe(channels ...string) error {
 	return sub.subUnsub("subscribe", channels...)
 }
 
-// Unsubscribe removes one or more channels from the subscription.
+// PSubscribe adds one or more patterns to the subscription.
+func (sub *Subscription) PSubscribe(patterns ...string) error {
+	return sub.send("psubscribe", patterns)
+}
+
+// Unsubscribe removes one or more channels from the subscription,
+// those containing patterns like with PUnsubscribe(). Without any
+// channel all channels but no patterns are removed. The confirmations
+// are received like the messages, which may still arrive until then.
 func (sub *Subscription) Unsubscribe(channels ...string) error {
 	return sub.subUnsub("unsubscribe", channels...)
 }
 
+// PUnsubscribe removes one or more patterns from the subscription.
+// Without any pattern all patterns are removed.
+func (sub *Subscription) PUnsubscribe(patterns ...string) error {
+	return sub.send("punsubscribe", patterns)
+}
+
 // subUnsub is the generic subscription and unsubscription method.
+// It separates the channels and the patterns.
 func (sub *Subscription) subUnsub(cmd string, channels ...string) error {
+	plain := []string{}
+	patterns := []string{}
+	for _, channel := range channels {
+		if containsPattern(channel) {
+			patterns = append(patterns, channel)
+		} else {
+			plain = append(plain, channel)
+		}
+	}
+	if len(plain) > 0 || len(patterns) == 0 {
+		if err := sub.send(cmd, plain); err != nil {
+			return err
+		}
+	}
+	if len(patterns) > 0 {
+		return sub.send("p"+cmd, patterns)
+	}
+	return nil
+}
+
+// send sends the subscription command for the channels.
+func (sub *Subscription) send(cmd string, channels []string) error {
 	err := sub.ensureProtocol()
 	if err != nil {
 		return err
 	}
-	pattern := false
 	args := []interface{}{}
 	for _, channel := range channels {
-		if containsPattern(channel) {
-			pattern = true
-		}
 		args = append(args, channel)
 	}
-	if pattern {
-		cmd = "p" + cmd
-	}
 	err = sub.resp.sendCommand(cmd, args...)
 	logCommand(cmd, args, err, sub.database.logging)
 	return err
 }
 
-// Pop waits for a published value and returns it.
-func (sub *Subscription) Pop() (*PublishedValue, error) {
+// Channel returns a channel delivering the received messages. A
+// goroutine receives them until the subscription is closed or an
+// error occurs, then the channel is closed. Pop cannot be used
+// anymore afterwards.
+func (sub *Subscription) Channel() <-chan *PubSubMessage {
+	if sub.messages != nil {
+		return sub.messages
+	}
+	sub.messages = make(chan *PubSubMessage, messageBufferSize)
+	sub.stop = make(chan struct{})
+	sub.done = make(chan struct{})
+	if err := sub.ensureProtocol(); err != nil {
+		sub.err = err
+		close(sub.messages)
+		close(sub.done)
+		return sub.messages
+	}
+	go sub.deliver()
+	return sub.messages
+}
+
+// Err returns the error which ended the delivery of messages
+// via the channel. It has to be called after the channel is
+// closed.
+func (sub *Subscription) Err() error {
+	return sub.err
+}
+
+// Receive waits for the next message. Opposite to Pop the message
+// also contains the matching pattern for pattern subscriptions.
+func (sub *Subscription) Receive() (*PubSubMessage, error) {
+	if sub.messages != nil {
+		return nil, failure.New("subscription delivers via channel")
+	}
 	err := sub.ensureProtocol()
 	if err != nil {
 		return nil, err
 	}
-	result, err := sub.resp.receiveResultSet()
+	return sub.receive()
+}
+
+// Pop waits for a published value and returns it. For pattern
+// subscriptions the channel is the one the value was published
+// to, the confirmations contain the pattern as channel.
+func (sub *Subscription) Pop() (*PublishedValue, error) {
+	msg, err := sub.Receive()
 	if err != nil {
 		return nil, err
 	}
-	// Analyse the result.
-	kind, err := result.StringAt(0)
-	if err != nil {
-		return nil, err
+	pv := &PublishedValue{
+		Kind:    msg.Kind,
+		Channel: msg.Channel,
+		Count:   msg.Count,
+		Value:   msg.Payload,
 	}
-	switch {
-	case strings.Contains(kind, "message"):
-		channel, err := result.StringAt(1)
-		if err != nil {
-			return nil, err
-		}
-		value, err := result.ValueAt(2)
-		if err != nil {
-			return nil, err
-		}
-		return &PublishedValue{
-			Kind:    kind,
-			Channel: channel,
-			Value:   value,
-		}, nil
-	case strings.Contains(kind, "subscribe"):
-		channel, err := result.StringAt(1)
-		if err != nil {
-			return nil, err
-		}
-		count, err := result.IntAt(2)
-		if err != nil {
-			return nil, err
-		}
-		return &PublishedValue{
-			Kind:    kind,
-			Channel: channel,
-			Count:   count,
-		}, nil
-	default:
-		return nil, failure.New("invalid server response: %q", result)
+	if pv.Channel == "" {
+		pv.Channel = msg.Pattern
 	}
+	return pv, nil
 }
 
 // Close ends the subscription.
 func (sub *Subscription) Close() error {
+	if sub.messages != nil {
+		return sub.closeChannel()
+	}
 	err := sub.ensureProtocol()
 	if err != nil {
 		return err
 	}
+	err = sub.resp.sendCommand("unsubscribe")
+	if err != nil {
+		return err
+	}
 	err = sub.resp.sendCommand("punsubscribe")
 	if err != nil {
 		return err
 	}
+	// Last confirmation has no remaining subscriptions.
 	for {
-		pv, err := sub.Pop()
+		msg, err := sub.receive()
 		if err != nil {
 			return err
 		}
-		if pv.Kind == "punsubscribe" {
+		if msg.Kind == "punsubscribe" && msg.Count == 0 {
 			break
 		}
 	}
+	sub.resp.readTimeout = sub.database.readTimeout
 	sub.database.pool.push(sub.resp)
 	return nil
 }
 
+// deliver receives the messages and sends them to the channel.
+func (sub *Subscription) deliver() {
+	defer close(sub.done)
+	defer close(sub.messages)
+	for {
+		msg, err := sub.receive()
+		if err != nil {
+			select {
+			case <-sub.stop:
+			default:
+				sub.err = err
+			}
+			return
+		}
+		select {
+		case sub.messages <- msg:
+		case <-sub.stop:
+			return
+		}
+	}
+}
+
+// closeChannel stops the delivery via channel. The protocol is
+// aborted while receiving, so it cannot be used anymore.
+func (sub *Subscription) closeChannel() error {
+	select {
+	case <-sub.stop:
+		return failure.New("subscription already closed")
+	default:
+	}
+	close(sub.stop)
+	if sub.resp == nil {
+		return nil
+	}
+	sub.resp.abort()
+	<-sub.done
+	err := sub.database.pool.kill(sub.resp)
+	sub.resp = nil
+	return err
+}
+
+// receive waits for the next message.
+func (sub *Subscription) receive() (*PubSubMessage, error) {
+	result, err := sub.resp.receiveResultSet()
+	if err != nil {
+		return nil, err
+	}
+	return parsePubSubMessage(result)
+}
+
 // ensureProtocol retrieves a protocol from the pool if needed.
 func (sub *Subscription) ensureProtocol() error {
 	if sub.resp == nil {
@@ -157,9 +274,63 @@ func (sub *Subscription) ensureProtocol() error {
 		if err != nil {
 			return err
 		}
+		// Pop waits for published values without timeout.
+		p.readTimeout = 0
 		sub.resp = p
 	}
 	return nil
 }
 
+//--------------------
+// HELPERS
+//--------------------
+
+// parsePubSubMessage converts the result set received by
+// a subscription into a message.
+func parsePubSubMessage(result *ResultSet) (*PubSubMessage, error) {
+	kind, err := result.StringAt(0)
+	if err != nil {
+		return nil, err
+	}
+	msg := &PubSubMessage{
+		Kind: kind,
+	}
+	switch kind {
+	case "message":
+		if msg.Channel, err = result.StringAt(1); err != nil {
+			return nil, err
+		}
+		if msg.Payload, err = result.ValueAt(2); err != nil {
+			return nil, err
+		}
+	case "pmessage":
+		if msg.Pattern, err = result.StringAt(1); err != nil {
+			return nil, err
+		}
+		if msg.Channel, err = result.StringAt(2); err != nil {
+			return nil, err
+		}
+		if msg.Payload, err = result.ValueAt(3); err != nil {
+			return nil, err
+		}
+	case "subscribe", "unsubscribe":
+		if msg.Channel, err = result.StringAt(1); err != nil {
+			return nil, err
+		}
+		if msg.Count, err = result.IntAt(2); err != nil {
+			return nil, err
+		}
+	case "psubscribe", "punsubscribe":
+		if msg.Pattern, err = result.StringAt(1); err != nil {
+			return nil, err
+		}
+		if msg.Count, err = result.IntAt(2); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, failure.New("invalid server response: %q", result)
+	}
+	return msg, nil
+}
+
 // EOF
@@ -15,6 +15,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"tideland.dev/go/trace/failure"
 	"tideland.dev/go/trace/logger"
@@ -30,6 +31,54 @@ type valuer interface {
 	Values() []Value
 }
 
+// idempotentCommands contains the commands which can be sent
+// again after a broken connection without changing the result.
+var idempotentCommands = map[string]bool{
+	"dbsize":           true,
+	"echo":             true,
+	"exists":           true,
+	"get":              true,
+	"getrange":         true,
+	"hexists":          true,
+	"hget":             true,
+	"hgetall":          true,
+	"hkeys":            true,
+	"hlen":             true,
+	"hmget":            true,
+	"hscan":            true,
+	"hstrlen":          true,
+	"hvals":            true,
+	"keys":             true,
+	"lindex":           true,
+	"llen":             true,
+	"lrange":           true,
+	"mget":             true,
+	"ping":             true,
+	"pttl":             true,
+	"scan":             true,
+	"scard":            true,
+	"sdiff":            true,
+	"sinter":           true,
+	"sismember":        true,
+	"smembers":         true,
+	"srandmember":      true,
+	"sscan":            true,
+	"strlen":           true,
+	"sunion":           true,
+	"ttl":              true,
+	"type":             true,
+	"zcard":            true,
+	"zcount":           true,
+	"zrange":           true,
+	"zrangebyscore":    true,
+	"zrank":            true,
+	"zrevrange":        true,
+	"zrevrangebyscore": true,
+	"zrevrank":         true,
+	"zscan":            true,
+	"zscore":           true,
+}
+
 // join builds a byte slice out of some parts.
 func join(parts ...interface{}) []byte {
 	tmp := []byte{}
@@ -48,13 +97,31 @@ func join(parts ...interface{}) []byte {
 	return tmp
 }
 
-// valueToBytes converts a value into a byte slice.
+// valueToBytes converts a value into a byte slice. Floats are
+// formatted with the smallest precision representing them exactly,
+// so that e.g. scores of sorted sets don't lose precision.
 func valueToBytes(value interface{}) []byte {
 	switch typedValue := value.(type) {
 	case string:
 		return []byte(typedValue)
 	case []byte:
 		return typedValue
+	case int:
+		return strconv.AppendInt(nil, int64(typedValue), 10)
+	case int64:
+		return strconv.AppendInt(nil, typedValue, 10)
+	case uint64:
+		return strconv.AppendUint(nil, typedValue, 10)
+	case float64:
+		return strconv.AppendFloat(nil, typedValue, 'g', -1, 64)
+	case bool:
+		return strconv.AppendBool(nil, typedValue)
+	case time.Duration:
+		return strconv.AppendInt(nil, int64(typedValue/time.Second), 10)
+	case PDuration:
+		return strconv.AppendInt(nil, int64(time.Duration(typedValue)/time.Millisecond), 10)
+	case time.Time:
+		return strconv.AppendInt(nil, typedValue.Unix(), 10)
 	case []string:
 		return []byte(strings.Join(typedValue, "\r\n"))
 	case map[string]string:
@@ -96,6 +163,7 @@ func logCommand(cmd string, args []interface{}, err error, log bool) {
 		for i, arg := range args {
 			output[i] = string(valueToBytes(arg))
 		}
+		maskPasswords(cmd, output)
 		return strings.Join(output, " / ")
 	}
 	logOutput := func() string {
@@ -116,4 +184,21 @@ func logCommand(cmd string, args []interface{}, err error, log bool) {
 	}
 }
 
+// maskPasswords replaces the passwords in the formatted arguments
+// of AUTH [username] password and HELLO ... AUTH username password.
+func maskPasswords(cmd string, args []string) {
+	switch cmd {
+	case "auth":
+		if len(args) > 0 {
+			args[len(args)-1] = "***"
+		}
+	case "hello":
+		for i := 0; i < len(args)-2; i++ {
+			if strings.ToLower(args[i]) == "auth" {
+				args[i+2] = "***"
+			}
+		}
+	}
+}
+
 // EOF
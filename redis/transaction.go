@@ -0,0 +1,162 @@
+// Tideland Go Database Clients - Redis Client
+//
+// Copyright (C) 2017-2020 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redis // import "tideland.dev/go/db/redis"
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"tideland.dev/go/trace/failure"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	// transactionRetries limits the retries of a transaction
+	// if watched keys have been changed.
+	transactionRetries = 10
+
+	// msgWatchedKeysChanged signals an aborted transaction.
+	msgWatchedKeysChanged = "transaction aborted, watched keys changed"
+)
+
+//--------------------
+// TRANSACTION
+//--------------------
+
+// TransactionFunc is a function reading the watched keys
+// and queuing the commands of a transaction.
+type TransactionFunc func(tx *Transaction) error
+
+// Transaction queues commands on a connection to execute
+// them atomically.
+type Transaction struct {
+	conn  *Connection
+	multi bool
+}
+
+// newTransaction creates a transaction on the given connection.
+func newTransaction(conn *Connection) *Transaction {
+	return &Transaction{
+		conn: conn,
+	}
+}
+
+// Connection returns the connection of the transaction. It can be
+// used to read the watched keys before queuing the first command.
+func (tx *Transaction) Connection() *Connection {
+	return tx.conn
+}
+
+// Do queues one Redis command. The first call starts
+// the transaction.
+func (tx *Transaction) Do(cmd string, args ...interface{}) error {
+	if !tx.multi {
+		ok, err := tx.conn.DoOK("multi")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return failure.New("cannot start transaction")
+		}
+		tx.multi = true
+	}
+	value, err := tx.conn.DoValue(cmd, args...)
+	if err != nil {
+		return err
+	}
+	if value.String() != "+QUEUED" {
+		return failure.New("cannot queue %s: %v", cmd, value)
+	}
+	return nil
+}
+
+// exec executes the queued commands and returns their results.
+func (tx *Transaction) exec() (*ResultSet, error) {
+	if !tx.multi {
+		return newResultSet(), tx.conn.Unwatch()
+	}
+	result, err := tx.conn.Do("exec")
+	if err != nil && IsTimeout(err) {
+		// EXEC answers with a null array if aborted.
+		return nil, failure.New(msgWatchedKeysChanged)
+	}
+	return result, err
+}
+
+// discard drops the queued commands.
+func (tx *Transaction) discard() error {
+	if !tx.multi {
+		return tx.conn.Unwatch()
+	}
+	_, err := tx.conn.Do("discard")
+	return err
+}
+
+//--------------------
+// DATABASE AND CONNECTION
+//--------------------
+
+// DoTransaction executes a transaction with optimistic locking on one
+// connection. The keys are watched before the function is called. If
+// one of them is changed before the queued commands are executed the
+// function is called again. The results of the commands are returned.
+func (db *Database) DoTransaction(keys []string, fn TransactionFunc) (*ResultSet, error) {
+	conn, err := db.Connection()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Return()
+	for i := 0; i < transactionRetries; i++ {
+		if err := conn.Watch(keys...); err != nil {
+			return nil, err
+		}
+		tx := newTransaction(conn)
+		if err := fn(tx); err != nil {
+			tx.discard()
+			return nil, err
+		}
+		result, err := tx.exec()
+		if err != nil {
+			if failure.Contains(err, msgWatchedKeysChanged) {
+				continue
+			}
+			return nil, err
+		}
+		return result, nil
+	}
+	return nil, failure.New("transaction failed after %d retries", transactionRetries)
+}
+
+// Watch marks the keys to be watched for a following transaction.
+// It is aborted if one of the keys is changed before its execution.
+func (conn *Connection) Watch(keys ...string) error {
+	args := make([]interface{}, len(keys))
+	for i, key := range keys {
+		args[i] = key
+	}
+	ok, err := conn.DoOK("watch", args...)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return failure.New("cannot watch keys %v", keys)
+	}
+	return nil
+}
+
+// Unwatch forgets all watched keys.
+func (conn *Connection) Unwatch() error {
+	_, err := conn.Do("unwatch")
+	return err
+}
+
+// EOF
@@ -13,8 +13,10 @@ package redis // import "tideland.dev/go/db/redis"
 
 import (
 	"fmt"
+	"reflect"
 	"strconv"
 	"strings"
+	"time"
 
 	"tideland.dev/go/trace/failure"
 )
@@ -49,8 +51,12 @@ func (v Value) IsNil() bool {
 	return v == nil
 }
 
-// Bool return the value as bool.
+// Bool return the value as bool. Beside the textual and numerical
+// representations like "true" or "1" the OK status is true.
 func (v Value) Bool() (bool, error) {
+	if v.IsOK() {
+		return true, nil
+	}
 	b, err := strconv.ParseBool(v.String())
 	if err != nil {
 		return false, v.invalidTypeError(err, "bool")
@@ -85,7 +91,8 @@ func (v Value) Uint64() (uint64, error) {
 	return i, nil
 }
 
-// Float64 returns the value as float64.
+// Float64 returns the value as float64. The special values
+// "inf", "-inf", and "nan" are supported too.
 func (v Value) Float64() (float64, error) {
 	f, err := strconv.ParseFloat(v.String(), 64)
 	if err != nil {
@@ -94,6 +101,38 @@ func (v Value) Float64() (float64, error) {
 	return f, nil
 }
 
+// Time returns the value interpreted as Unix time in seconds,
+// e.g. like the first element of TIME or a stored timestamp.
+func (v Value) Time() (time.Time, error) {
+	seconds, err := strconv.ParseInt(v.String(), 10, 64)
+	if err != nil {
+		return time.Time{}, v.invalidTypeError(err, "time")
+	}
+	return time.Unix(seconds, 0), nil
+}
+
+// Duration returns the value interpreted as number of seconds like
+// returned by TTL. The negative special values -1 for keys without
+// expiration and -2 for missing keys are returned as -1s and -2s.
+func (v Value) Duration() (time.Duration, error) {
+	seconds, err := strconv.ParseInt(v.String(), 10, 64)
+	if err != nil {
+		return 0, v.invalidTypeError(err, "duration")
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// PDuration returns the value interpreted as number of milliseconds
+// like returned by PTTL. The negative special values -1 for keys without
+// expiration and -2 for missing keys are returned as -1ms and -2ms.
+func (v Value) PDuration() (time.Duration, error) {
+	milliseconds, err := strconv.ParseInt(v.String(), 10, 64)
+	if err != nil {
+		return 0, v.invalidTypeError(err, "duration")
+	}
+	return time.Duration(milliseconds) * time.Millisecond, nil
+}
+
 // Bytes returns the value as byte slice.
 func (v Value) Bytes() []byte {
 	return []byte(v)
@@ -181,6 +220,15 @@ func (kvs KeyValues) String() string {
 	return fmt.Sprintf("[%s]", strings.Join(kvss, " / "))
 }
 
+//--------------------
+// PRECISE DURATION
+//--------------------
+
+// PDuration is a duration passed as number of milliseconds, e.g. for
+// PEXPIRE or PSETEX. A plain time.Duration is passed as number of
+// whole seconds.
+type PDuration time.Duration
+
 //--------------------
 // SCORED VALUE
 //--------------------
@@ -318,6 +366,43 @@ func (h Hash) StringMap(key string) map[string]string {
 	return map[string]string{}
 }
 
+// ScanStruct sets the fields of the struct dest points to with the
+// values of the hash. The hash keys are matched by the field tags
+// `redis:"key"` or by the field names. Fields tagged with "-" are
+// ignored, as well as keys without a matching field. Supported are
+// strings, byte slices, integers, floats, bools, and time.Time as
+// unix seconds.
+func (h Hash) ScanStruct(dest interface{}) error {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return failure.New("destination is no pointer to a struct")
+	}
+	sv := rv.Elem()
+	st := sv.Type()
+	for i := 0; i < st.NumField(); i++ {
+		sf := st.Field(i)
+		if sf.PkgPath != "" {
+			// Unexported field.
+			continue
+		}
+		key := sf.Name
+		if tag, ok := sf.Tag.Lookup("redis"); ok {
+			if tag == "-" {
+				continue
+			}
+			key = tag
+		}
+		value, ok := h[key]
+		if !ok {
+			continue
+		}
+		if err := setField(sv.Field(i), value); err != nil {
+			return failure.Annotate(err, "cannot set field %q", sf.Name)
+		}
+	}
+	return nil
+}
+
 // Hashable represents types for Redis hashes.
 type Hashable interface {
 	Len() int
@@ -338,4 +423,87 @@ type PublishedValue struct {
 	Value   Value
 }
 
+// PubSubMessage contains a message received by a subscription. The
+// kind is "message" or "pmessage" for published payloads, then the
+// pattern is set for the latter. Otherwise it is the confirmation of
+// a subscription change with the current number of subscriptions.
+type PubSubMessage struct {
+	Kind    string
+	Channel string
+	Pattern string
+	Count   int
+	Payload Value
+}
+
+//--------------------
+// STREAM ENTRY
+//--------------------
+
+// StreamEntry contains one entry of a stream with its ID
+// and its fields.
+type StreamEntry struct {
+	ID     string
+	Fields Hash
+}
+
+// StreamEntries is a list of stream entries.
+type StreamEntries []StreamEntry
+
+// Len returns the number of stream entries.
+func (ses StreamEntries) Len() int {
+	return len(ses)
+}
+
+//--------------------
+// HELPERS
+//--------------------
+
+// setField sets the struct field to the converted value.
+func setField(field reflect.Value, value Value) error {
+	if field.Type() == reflect.TypeOf(time.Time{}) {
+		t, err := value.Time()
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(t))
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value.String())
+	case reflect.Bool:
+		b, err := value.Bool()
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := value.Int64()
+		if err != nil {
+			return err
+		}
+		field.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := value.Uint64()
+		if err != nil {
+			return err
+		}
+		field.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := value.Float64()
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.Uint8 {
+			return failure.New("unsupported field type %v", field.Type())
+		}
+		field.SetBytes(append([]byte{}, value...))
+	default:
+		return failure.New("unsupported field type %v", field.Type())
+	}
+	return nil
+}
+
 // EOF